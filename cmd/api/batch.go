@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/wangyaodream/greenlight/internal/data"
+	"github.com/wangyaodream/greenlight/internal/validator"
+)
+
+// errBatchFailed 用于在原子模式下中止事务
+var errBatchFailed = errors.New("batch operation failed")
+
+// batchOperation 是批量接口中的一个操作，update 时 movie 中没有传入的字段保持不变
+type batchOperation struct {
+	Op      string `json:"op"`
+	ID      int64  `json:"id"`
+	Version int32  `json:"version"`
+	Movie   struct {
+		Title   *string       `json:"title"`
+		Year    *int32        `json:"year"`
+		Runtime *data.Runtime `json:"runtime"`
+		Genres  []string      `json:"genres"`
+	} `json:"movie"`
+}
+
+type batchResult struct {
+	Index  int               `json:"index"`
+	Op     string            `json:"op"`
+	Status int               `json:"status"`
+	ID     int64             `json:"id,omitempty"`
+	Movie  *data.Movie       `json:"movie,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+func (app *application) batchMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Atomic     bool             `json:"atomic"`
+		Operations []batchOperation `json:"operations"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Operations) > 0, "operations", "must contain at least 1 operation")
+	v.Check(len(input.Operations) <= 1000, "operations", "must not contain more than 1000 operations")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	genres, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	editorID := app.contextGetUser(r).ID
+	results := make([]batchResult, 0, len(input.Operations))
+
+	// 非原子模式下每个操作独立执行，单个操作失败不影响其他操作。
+	// 前面的操作已经提交，服务器错误也只记录在对应操作的结果中，而不是让整个请求返回500
+	if !input.Atomic {
+		for i, op := range input.Operations {
+			result, err := app.runBatchOperation(app.models.Movies, genres, i, op, editorID)
+			if err != nil {
+				app.logError(r, err)
+				result.Status = http.StatusInternalServerError
+				result.Errors = map[string]string{"error": "the server encountered a problem and could not process this operation"}
+			}
+			results = append(results, result)
+		}
+
+		err = app.writeResponse(w, r, http.StatusOK, envelope{"results": results}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// 原子模式下所有操作在同一个事务中执行，任意一个操作失败时回滚全部操作
+	var failed batchResult
+
+	err = app.models.Movies.InTx(func(movies data.MovieModel) error {
+		for i, op := range input.Operations {
+			result, err := app.runBatchOperation(movies, genres, i, op, editorID)
+			if err != nil {
+				return err
+			}
+
+			if result.Status >= 400 {
+				failed = result
+				return errBatchFailed
+			}
+
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errBatchFailed):
+			app.errorResponse(w, r, failed.Status, failed)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runBatchOperation 执行单个操作，操作本身的失败记录在batchResult中，只有服务器错误才会返回error
+func (app *application) runBatchOperation(movies data.MovieModel, genres *data.GenreTaxonomy, index int, op batchOperation, editorID int64) (batchResult, error) {
+	result := batchResult{Index: index, Op: op.Op, ID: op.ID}
+	v := validator.New()
+
+	switch op.Op {
+	case "create":
+		movie := &data.Movie{}
+		applyBatchFields(movie, op)
+
+		if data.ValidateMovie(v, movie, genres); !v.Valid() {
+			result.Status, result.Errors = http.StatusUnprocessableEntity, v.Errors
+			return result, nil
+		}
+
+		err := movies.Insert(movie, editorID)
+		if err != nil {
+			return result, err
+		}
+
+		result.Status, result.ID, result.Movie = http.StatusCreated, movie.ID, movie
+
+	case "update":
+		movie, err := movies.Get(op.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				result.Status, result.Errors = http.StatusNotFound, map[string]string{"id": "movie does not exist"}
+				return result, nil
+			default:
+				return result, err
+			}
+		}
+
+		// version 为可选参数，传入时必须与当前版本一致
+		if op.Version != 0 && op.Version != movie.Version {
+			result.Status, result.Errors = http.StatusConflict, map[string]string{"version": "does not match the current version"}
+			return result, nil
+		}
+
+		applyBatchFields(movie, op)
+
+		if data.ValidateMovie(v, movie, genres); !v.Valid() {
+			result.Status, result.Errors = http.StatusUnprocessableEntity, v.Errors
+			return result, nil
+		}
+
+		err = movies.Update(movie, editorID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				result.Status, result.Errors = http.StatusConflict, map[string]string{"version": "edit conflict"}
+				return result, nil
+			default:
+				return result, err
+			}
+		}
+
+		result.Status, result.Movie = http.StatusOK, movie
+
+	case "delete":
+		// version 为可选参数，传入时必须与当前版本一致
+		err := movies.Delete(op.ID, op.Version, editorID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				result.Status, result.Errors = http.StatusNotFound, map[string]string{"id": "movie does not exist"}
+				return result, nil
+			case errors.Is(err, data.ErrEditConflict):
+				result.Status, result.Errors = http.StatusConflict, map[string]string{"version": "does not match the current version"}
+				return result, nil
+			default:
+				return result, err
+			}
+		}
+
+		result.Status = http.StatusOK
+
+	default:
+		result.Status, result.Errors = http.StatusUnprocessableEntity, map[string]string{"op": "must be one of create, update or delete"}
+	}
+
+	return result, nil
+}
+
+func applyBatchFields(movie *data.Movie, op batchOperation) {
+	if op.Movie.Title != nil {
+		movie.Title = *op.Movie.Title
+	}
+
+	if op.Movie.Year != nil {
+		movie.Year = *op.Movie.Year
+	}
+
+	if op.Movie.Runtime != nil {
+		movie.Runtime = *op.Movie.Runtime
+	}
+
+	if op.Movie.Genres != nil {
+		movie.Genres = op.Movie.Genres
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/wangyaodream/greenlight/internal/data"
+	"github.com/wangyaodream/greenlight/internal/jsonlog"
+	"github.com/wangyaodream/greenlight/internal/settings"
+	"github.com/wangyaodream/greenlight/internal/validator"
+)
+
+// envPrefix 是配置使用的环境变量前缀，例如GREENLIGHT_DB_DSN对应-db-dsn
+const envPrefix = "GREENLIGHT"
+
+// legacyEnv 是仍然支持的旧环境变量名称，优先级低于对应的GREENLIGHT_*变量
+var legacyEnv = map[string]string{
+	"smtp-username": "MAIL_USERNAME",
+	"smtp-password": "MAIL_PASSWORD",
+}
+
+// setting 是一项生效的配置以及它的来源：default、file、env或flag
+type setting struct {
+	name   string
+	value  string
+	source string
+}
+
+// parseConfig 按照默认值、配置文件、环境变量、命令行参数的顺序加载配置，后面的来源覆盖前面的来源。
+// 配置文件和环境变量使用与命令行参数相同的名称，配置文件中出现未知的名称时返回错误
+func parseConfig(args []string, environ []string) (config, error) {
+	var cfg config
+
+	fs := flag.NewFlagSet("api", flag.ExitOnError)
+
+	fs.StringVar(&cfg.configFile, "config", "", "Configuration file (.yaml, .yml or .toml), also read from "+envPrefix+"_CONFIG")
+	fs.BoolVar(&cfg.printConfig, "print-config", false, "Print the effective configuration with secrets redacted and exit")
+
+	// command-line 设定参数
+	fs.IntVar(&cfg.port, "port", 4000, "Server port to listen on")
+	fs.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	// HTTPS，证书文件被替换后会自动重新加载
+	fs.StringVar(&cfg.tls.certFile, "tls-cert", "", "TLS certificate file, serves HTTPS together with -tls-key")
+	fs.StringVar(&cfg.tls.keyFile, "tls-key", "", "TLS private key file, serves HTTPS together with -tls-cert")
+	fs.IntVar(&cfg.tls.redirectPort, "tls-redirect-port", 0, "Port redirecting plain HTTP requests to HTTPS, 0 disables the redirect")
+	// database dsn
+	fs.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
+	// 设定数据库连接池的最大连接数
+	fs.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
+	// 设定数据库连接池的最大空闲连接数
+	fs.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
+	// 设定数据库连接池的最大空闲时间
+	fs.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max idle time")
+
+	// 限流器的设定
+	fs.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
+	fs.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter burst")
+	fs.BoolVar(&cfg.limiter.enabled, "limiter-enabled", false, "Enable rate limiter")
+	// 标题联想接口的独立限流器
+	fs.Float64Var(&cfg.suggestLimiter.rps, "suggest-limiter-rps", 10, "Title suggestion rate limiter maximum requests per second")
+	fs.IntVar(&cfg.suggestLimiter.burst, "suggest-limiter-burst", 20, "Title suggestion rate limiter burst")
+	// 邮件的发送方式，本地开发时可以写入文件或者日志
+	fs.StringVar(&cfg.mailer.transport, "mailer", "smtp", "Mail transport (smtp|file|log|memory; file, log and memory only with -env=development)")
+	fs.StringVar(&cfg.mailer.dir, "mailer-dir", "tmp/emails", "Directory for .eml files written by the file mail transport")
+	// SMTP
+	fs.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
+	fs.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	fs.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	fs.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	fs.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <no-reply@greenlight.wangyaodream.net>", "SMTP sender")
+
+	// CORS
+	fs.Var((*originsValue)(&cfg.cors.trustedOrigins), "cors-trusted-origins", "List of trusted CORS origins separated by spaces or commas")
+
+	// 全文搜索使用的文本搜索配置
+	fs.StringVar(&cfg.search.config, "search-config", "simple", "PostgreSQL text search configuration (simple|english|...)")
+	// 软删除的电影在保留期之后由后台任务永久删除
+	fs.DurationVar(&cfg.purge.retention, "purge-retention", 30*24*time.Hour, "Retention period for soft-deleted movies before they are purged")
+	fs.DurationVar(&cfg.purge.interval, "purge-interval", time.Hour, "Interval between purges of soft-deleted movies")
+	// 发件箱中的邮件由后台worker发送，失败时按照指数退避重试
+	fs.IntVar(&cfg.email.workers, "email-workers", 2, "Number of workers sending queued emails")
+	fs.IntVar(&cfg.email.maxAttempts, "email-max-attempts", 8, "Maximum send attempts before an email is marked as dead")
+	fs.DurationVar(&cfg.email.pollInterval, "email-poll-interval", 5*time.Second, "Interval between checks for queued emails when the outbox is empty")
+
+	// 日志级别，低于该级别的日志不会输出
+	cfg.log.level = jsonlog.LevelInfo
+	fs.Var((*levelValue)(&cfg.log.level), "log-level", "Minimum log level (debug|info|warn|error|fatal|off)")
+	fs.BoolVar(&cfg.log.stackTraces, "log-stack-traces", false, "Include stack traces in error and fatal log entries")
+	// 日志可以同时写入标准输出和按大小、时间轮转的文件，每个目标可以只接收部分级别
+	fs.Var((*levelsValue)(&cfg.log.stdoutLevels), "log-stdout-levels", "Comma-separated log levels written to stdout, all levels when empty")
+	fs.StringVar(&cfg.log.file, "log-file", "", "Also write logs to this file, rotated according to the -log-file-* settings")
+	fs.Var((*levelsValue)(&cfg.log.fileLevels), "log-file-levels", "Comma-separated log levels written to -log-file, all levels when empty")
+	cfg.log.rotate.MaxSize = 100 << 20
+	fs.Var((*megabytesValue)(&cfg.log.rotate.MaxSize), "log-file-max-size", "Rotate the log file when it exceeds this many megabytes, 0 disables size-based rotation")
+	fs.DurationVar(&cfg.log.rotate.Interval, "log-file-rotate-interval", 24*time.Hour, "Rotate the log file after this long, 0 disables time-based rotation")
+	fs.IntVar(&cfg.log.rotate.MaxBackups, "log-file-max-backups", 7, "Number of rotated log files to keep, 0 keeps all")
+	fs.DurationVar(&cfg.log.rotate.MaxAge, "log-file-max-age", 7*24*time.Hour, "Delete rotated log files older than this, 0 keeps them regardless of age")
+	// 重复的INFO日志按照消息内容采样，避免错误风暴时日志占满磁盘
+	fs.DurationVar(&cfg.log.sample.interval, "log-sample-interval", time.Second, "Window in which repeated INFO messages are counted for sampling")
+	fs.IntVar(&cfg.log.sample.first, "log-sample-first", 100, "Repeated INFO messages logged per window before sampling starts, 0 disables sampling")
+	fs.IntVar(&cfg.log.sample.thereafter, "log-sample-thereafter", 100, "After -log-sample-first, log every Nth repeated INFO message in the window")
+
+	fs.Parse(args)
+
+	sources := make(map[string]string)
+
+	// 命令行中出现的参数优先级最高，不会被配置文件和环境变量覆盖
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+		sources[f.Name] = "flag"
+	})
+
+	env := settings.FromEnv(envPrefix, environ)
+
+	// 早期版本从MAIL_USERNAME和MAIL_PASSWORD读取SMTP账号，没有设置对应的GREENLIGHT_*变量时仍然使用它们
+	for name, legacy := range legacyEnv {
+		if _, ok := env[name]; ok {
+			continue
+		}
+		for _, kv := range environ {
+			if key, value, ok := strings.Cut(kv, "="); ok && key == legacy {
+				env[name] = value
+			}
+		}
+	}
+
+	if !explicit["config"] && env["config"] != "" {
+		cfg.configFile = env["config"]
+		sources["config"] = "env"
+	}
+
+	type layer struct {
+		source string
+		values map[string]string
+	}
+
+	var layers []layer
+
+	if cfg.configFile != "" {
+		values, err := settings.ReadFile(cfg.configFile)
+		if err != nil {
+			return cfg, err
+		}
+		layers = append(layers, layer{"file", values})
+	}
+
+	layers = append(layers, layer{"env", env})
+
+	for _, l := range layers {
+		names := make([]string, 0, len(l.values))
+		for name := range l.values {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for _, name := range names {
+			f := fs.Lookup(name)
+
+			// 环境变量中可能有与配置无关的GREENLIGHT_*变量，所以只有配置文件中的未知名称才是错误
+			if f == nil || name == "config" || name == "print-config" {
+				if l.source == "file" {
+					return cfg, fmt.Errorf("%s: unknown setting %q", cfg.configFile, name)
+				}
+				continue
+			}
+
+			if explicit[name] {
+				continue
+			}
+
+			if err := f.Value.Set(l.values[name]); err != nil {
+				return cfg, fmt.Errorf("%s: invalid value %q for %s: %w", l.source, l.values[name], name, err)
+			}
+			sources[name] = l.source
+		}
+	}
+
+	// config和print-config不是配置项，不记录在settings中，这样print的输出可以直接作为TOML配置文件使用
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+
+		source, ok := sources[f.Name]
+		if !ok {
+			source = "default"
+		}
+		cfg.settings = append(cfg.settings, setting{name: f.Name, value: f.Value.String(), source: source})
+	})
+
+	return cfg, nil
+}
+
+// validateConfig 检查配置的取值范围，返回每一项无效配置的原因，键为配置的名称
+func validateConfig(cfg config) map[string]string {
+	v := validator.New()
+
+	v.Check(cfg.port > 0 && cfg.port <= 65535, "port", "must be between 1 and 65535")
+	v.Check(validator.PermiteedValue(cfg.env, "development", "staging", "production"), "env", "must be one of development, staging or production")
+
+	v.Check((cfg.tls.certFile == "") == (cfg.tls.keyFile == ""), "tls-cert", "must be provided together with -tls-key")
+	if cfg.tls.redirectPort != 0 {
+		v.Check(cfg.tls.certFile != "", "tls-redirect-port", "requires -tls-cert and -tls-key")
+		v.Check(cfg.tls.redirectPort > 0 && cfg.tls.redirectPort <= 65535, "tls-redirect-port", "must be between 1 and 65535")
+		v.Check(cfg.tls.redirectPort != cfg.port, "tls-redirect-port", "must be different from -port")
+	}
+
+	v.Check(cfg.db.dsn != "", "db-dsn", "must be provided")
+	v.Check(cfg.db.maxOpenConns > 0, "db-max-open-conns", "must be greater than zero")
+	v.Check(cfg.db.maxIdleConns >= 0, "db-max-idle-conns", "must not be negative")
+	_, err := time.ParseDuration(cfg.db.maxIdleTime)
+	v.Check(err == nil, "db-max-idle-time", "must be a duration such as 15m")
+
+	v.Check(cfg.limiter.rps > 0, "limiter-rps", "must be greater than zero")
+	v.Check(cfg.limiter.burst > 0, "limiter-burst", "must be greater than zero")
+	v.Check(cfg.suggestLimiter.rps > 0, "suggest-limiter-rps", "must be greater than zero")
+	v.Check(cfg.suggestLimiter.burst > 0, "suggest-limiter-burst", "must be greater than zero")
+
+	v.Check(validator.PermiteedValue(cfg.mailer.transport, "smtp", "file", "log", "memory"), "mailer", "must be one of smtp, file, log or memory")
+	// file、log和memory不会真正发送邮件，只能在开发环境中使用，避免生产环境的激活邮件被悄悄丢弃
+	if cfg.mailer.transport != "smtp" {
+		v.Check(cfg.env == "development", "mailer", "must be smtp unless -env is development")
+	}
+	if cfg.mailer.transport == "file" {
+		v.Check(cfg.mailer.dir != "", "mailer-dir", "must be provided when -mailer is file")
+	}
+	v.Check(cfg.smtp.port > 0 && cfg.smtp.port <= 65535, "smtp-port", "must be between 1 and 65535")
+	v.Check(cfg.smtp.sender != "", "smtp-sender", "must be provided")
+
+	for _, origin := range cfg.cors.trustedOrigins {
+		u, err := url.Parse(origin)
+		v.Check(err == nil && u.Scheme != "" && u.Host != "", "cors-trusted-origins", "must be origins such as https://www.example.com")
+	}
+
+	// 文本搜索配置会被拼接到SQL中，所以必须在允许的范围内
+	v.Check(validator.PermiteedValue(cfg.search.config, data.SearchConfigSafelist...), "search-config", "must be a supported text search configuration")
+	v.Check(cfg.purge.retention >= 0, "purge-retention", "must not be negative")
+	v.Check(cfg.purge.interval > 0, "purge-interval", "must be greater than zero")
+
+	v.Check(cfg.email.workers > 0, "email-workers", "must be greater than zero")
+	v.Check(cfg.email.maxAttempts > 0, "email-max-attempts", "must be greater than zero")
+	v.Check(cfg.email.pollInterval > 0, "email-poll-interval", "must be greater than zero")
+
+	v.Check(cfg.log.rotate.Interval >= 0, "log-file-rotate-interval", "must not be negative")
+	v.Check(cfg.log.rotate.MaxBackups >= 0, "log-file-max-backups", "must not be negative")
+	v.Check(cfg.log.rotate.MaxAge >= 0, "log-file-max-age", "must not be negative")
+	v.Check(cfg.log.sample.first >= 0, "log-sample-first", "must not be negative")
+	v.Check(cfg.log.sample.thereafter >= 0, "log-sample-thereafter", "must not be negative")
+	if cfg.log.sample.first > 0 {
+		v.Check(cfg.log.sample.interval > 0, "log-sample-interval", "must be greater than zero when sampling is enabled")
+	}
+
+	return v.Errors
+}
+
+// print 以配置文件的格式输出生效的配置和每一项的来源，密码等敏感信息会被隐藏。
+// errs是validateConfig返回的错误，无效的配置项在注释中标出原因
+func (cfg config) print(w io.Writer, errs map[string]string) {
+	for _, s := range cfg.settings {
+		fmt.Fprintf(w, "%s = %s # %s", s.name, strconv.Quote(redact(s.name, s.value)), s.source)
+		if message, ok := errs[s.name]; ok {
+			fmt.Fprintf(w, ", invalid: %s", message)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// dsnPasswordRX 匹配key=value形式的DSN中的密码
+var dsnPasswordRX = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// redact 隐藏配置中的敏感信息
+func redact(name, value string) string {
+	switch {
+	case value == "":
+		return value
+	case strings.Contains(name, "password"):
+		return "xxxxx"
+	case name == "db-dsn":
+		if !strings.Contains(value, "://") {
+			return dsnPasswordRX.ReplaceAllString(value, "${1}xxxxx")
+		}
+
+		// 无法解析的URL中可能有未编码的密码，例如包含%或#的密码，这时隐藏整个值
+		u, err := url.Parse(value)
+		if err != nil || u.Fragment != "" {
+			return "xxxxx"
+		}
+
+		// 密码也可以通过password查询参数传入
+		if q := u.Query(); q.Has("password") {
+			q.Set("password", "xxxxx")
+			u.RawQuery = q.Encode()
+		}
+		return u.Redacted()
+	default:
+		return value
+	}
+}
+
+// originsValue 是以空白或逗号分隔的来源列表
+type originsValue []string
+
+func (o *originsValue) String() string {
+	return strings.Join(*o, " ")
+}
+
+func (o *originsValue) Set(val string) error {
+	*o = strings.FieldsFunc(val, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	return nil
+}
+
+type levelValue jsonlog.Level
+
+func (l *levelValue) String() string {
+	return strings.ToLower(jsonlog.Level(*l).String())
+}
+
+func (l *levelValue) Set(val string) error {
+	level, err := jsonlog.ParseLevel(val)
+	if err != nil {
+		return err
+	}
+	*l = levelValue(level)
+	return nil
+}
+
+// levelsValue 是逗号分隔的日志级别列表
+type levelsValue []jsonlog.Level
+
+func (l *levelsValue) String() string {
+	names := make([]string, len(*l))
+	for i, level := range *l {
+		names[i] = strings.ToLower(level.String())
+	}
+	return strings.Join(names, ",")
+}
+
+func (l *levelsValue) Set(val string) error {
+	levels, err := jsonlog.ParseLevels(val)
+	if err != nil {
+		return err
+	}
+	*l = levels
+	return nil
+}
+
+// megabytesValue 以MB为单位设置字节数
+type megabytesValue int64
+
+func (m *megabytesValue) String() string {
+	return strconv.FormatInt(int64(*m)>>20, 10)
+}
+
+func (m *megabytesValue) Set(val string) error {
+	mb, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || mb < 0 {
+		return fmt.Errorf("must be a non-negative number of megabytes")
+	}
+	*m = megabytesValue(mb << 20)
+	return nil
+}
@@ -3,7 +3,7 @@ package main
 import "net/http"
 
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.PrintError(err, map[string]string{
+	app.logger.PrintError(err, map[string]any{
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
 	})
@@ -11,7 +11,7 @@ func (app *application) logError(r *http.Request, err error) {
 
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
 	env := envelope{"error": message}
-	err := app.writeJSON(w, status, env, nil)
+	err := app.writeResponse(w, r, status, env, nil)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(500)
@@ -79,3 +79,13 @@ func (app *application) notPermitedResponse(w http.ResponseWriter, r *http.Reque
     message := "your account does not have the necessary permissions to access this resource"
     app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+    message := "the resource has been modified since the version given in the If-Match header"
+    app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+    message := "the requested resource is not available in any of the formats given in the Accept header"
+    app.errorResponse(w, r, http.StatusNotAcceptable, message)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wangyaodream/greenlight/internal/data"
+	"github.com/wangyaodream/greenlight/internal/render"
+	"github.com/wangyaodream/greenlight/internal/validator"
+)
+
+// movieExporter 把电影逐条写入响应，flush把缓冲的数据写入响应，close在所有电影写完之后调用
+type movieExporter interface {
+	write(movie *data.Movie) error
+	flush() error
+	close() error
+}
+
+// exportFormats 保存每种导出格式的媒体类型和文件扩展名
+var exportFormats = map[string]struct {
+	mediaType string
+	extension string
+}{
+	"csv":    {render.CSV, "csv"},
+	"ndjson": {"application/x-ndjson", "ndjson"},
+	"json":   {render.JSON, "json"},
+}
+
+// exportFlushEvery 是两次刷新响应之间写入的电影数量
+const exportFlushEvery = 500
+
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filter := app.readMovieFilter(qs, v)
+
+	// 没有format参数时按照Accept请求头选择格式，默认为csv
+	format := app.readString(qs, "format", "")
+	if format == "" {
+		var ok bool
+		if format, ok = exportFormat(r.Header.Get("Accept")); !ok {
+			app.notAcceptableResponse(w, r)
+			return
+		}
+	}
+
+	filters := data.Filters{
+		Sort:         app.readString(qs, "sort", "id"),
+		SortSafelist: movieSortSafelist,
+	}
+
+	_, ok := exportFormats[format]
+	v.Check(ok, "format", "must be one of csv, ndjson or json")
+	v.Check(validator.PermiteedValue(filters.Sort, filters.SortSafelist...), "sort", "invalid sort value")
+
+	if data.ValidateMovieFilter(v, filter); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err := app.canonicalizeMovieFilter(&filter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// 导出可能持续很长时间，取消服务器的写超时
+	rc := http.NewResponseController(w)
+	err = rc.SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", render.ContentType(exportFormats[format].mediaType))
+	w.Header().Set("Content-Disposition", `attachment; filename="movies.`+exportFormats[format].extension+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	exporter, err := newMovieExporter(format, w)
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	count := 0
+
+	err = app.models.Movies.Export(r.Context(), filter, filters, func(movie *data.Movie) error {
+		if err := exporter.write(movie); err != nil {
+			return err
+		}
+
+		count++
+		if count%exportFlushEvery == 0 {
+			if err := exporter.flush(); err != nil {
+				return err
+			}
+			return flushResponse(rc)
+		}
+
+		return nil
+	})
+	if err == nil {
+		err = exporter.close()
+	}
+
+	if err != nil {
+		// 响应头已经发送，出错时只能记录日志并中断响应，客户端断开连接不是错误
+		if !errors.Is(err, context.Canceled) {
+			app.logError(r, err)
+		}
+		return
+	}
+
+	err = flushResponse(rc)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// exportFormat 按照Accept请求头选择导出格式
+func exportFormat(accept string) (string, bool) {
+	formats := []string{"csv", "ndjson", "json"}
+
+	offers := make([]string, len(formats))
+	for i, format := range formats {
+		offers[i] = exportFormats[format].mediaType
+	}
+
+	mediaType, ok := render.Negotiate(accept, offers...)
+	if !ok {
+		return "", false
+	}
+
+	for _, format := range formats {
+		if exportFormats[format].mediaType == mediaType {
+			return format, true
+		}
+	}
+
+	return "", false
+}
+
+func flushResponse(rc *http.ResponseController) error {
+	err := rc.Flush()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+	return err
+}
+
+func newMovieExporter(format string, w io.Writer) (movieExporter, error) {
+	switch format {
+	case "csv":
+		e := &csvExporter{w: csv.NewWriter(w)}
+		// 表头与导入命令默认识别的列名一致，导出的文件可以直接重新导入
+		return e, e.w.Write([]string{"id", "title", "year", "runtime_minutes", "genres", "version"})
+	case "ndjson":
+		return &ndjsonExporter{enc: json.NewEncoder(w)}, nil
+	default:
+		_, err := io.WriteString(w, "[")
+		return &jsonExporter{w: w}, err
+	}
+}
+
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvExporter) write(movie *data.Movie) error {
+	return e.w.Write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.Title,
+		strconv.Itoa(int(movie.Year)),
+		strconv.Itoa(int(movie.Runtime)),
+		strings.Join(movie.Genres, "|"),
+		strconv.Itoa(int(movie.Version)),
+	})
+}
+
+func (e *csvExporter) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExporter) close() error {
+	return e.flush()
+}
+
+type ndjsonExporter struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExporter) write(movie *data.Movie) error {
+	return e.enc.Encode(movie)
+}
+
+func (e *ndjsonExporter) flush() error {
+	return nil
+}
+
+func (e *ndjsonExporter) close() error {
+	return nil
+}
+
+// jsonExporter 输出一个JSON数组，元素之间用换行分隔
+type jsonExporter struct {
+	w       io.Writer
+	written bool
+}
+
+func (e *jsonExporter) write(movie *data.Movie) error {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return err
+	}
+
+	separator := "\n"
+	if e.written {
+		separator = ",\n"
+	}
+	e.written = true
+
+	_, err = io.WriteString(e.w, separator+string(js))
+	return err
+}
+
+func (e *jsonExporter) flush() error {
+	return nil
+}
+
+func (e *jsonExporter) close() error {
+	_, err := io.WriteString(e.w, "\n]\n")
+	return err
+}
@@ -13,8 +13,8 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 		},
 	}
 
-	// 使用自定义模块helper中的writeJSON来转换数据
-	err := app.writeJSON(w, http.StatusOK, env, nil)
+	// 使用自定义模块helper中的writeResponse来转换数据
+	err := app.writeResponse(w, r, http.StatusOK, env, nil)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -1,47 +1,157 @@
 package main
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/wangyaodream/greenlight/internal/data"
+	"github.com/wangyaodream/greenlight/internal/render"
 	"github.com/wangyaodream/greenlight/internal/validator"
 )
 
 type envelope map[string]any
 
-func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	js, err := json.MarshalIndent(data, "", "\t")
+// etagSuffixes 是各个格式加在ETag中的后缀，同一版本的不同格式使用不同的强标签，JSON保持原来的标签
+var etagSuffixes = map[string]string{
+	render.XML:         "xml",
+	render.CSV:         "csv",
+	render.MessagePack: "msgpack",
+}
+
+// writeResponse 按照Accept请求头选择格式编码data并写入响应，只有顶层恰好包含一个数组的响应可以编码为CSV。
+// negotiateContent已经拒绝了不接受任何格式的请求，剩下只接受CSV而data不是表格的情况返回406，
+// 这种情况下的错误响应使用JSON。
+// headers中有ETag时按照格式派生ETag，GET请求的If-None-Match与之匹配时返回304
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	doc, err := render.NewDocument(data)
 	if err != nil {
 		return err
 	}
 
-	js = append(js, '\n')
+	offers := []string{render.JSON, render.XML, render.MessagePack}
+	if doc.Tabular() {
+		offers = append(offers, render.CSV)
+	}
+
+	// 没有可接受的格式时返回406，例如对非表格数据只接受text/csv。
+	// 错误响应本身无法协商时仍然使用JSON，否则406响应也无法输出
+	mediaType, ok := render.Negotiate(r.Header.Get("Accept"), offers...)
+	if !ok {
+		if status < http.StatusBadRequest {
+			app.notAcceptableResponse(w, r)
+			return nil
+		}
+		mediaType = render.JSON
+	}
 
-	// Add the content type header.
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	// 304响应同样依赖Accept请求头，所以总是设置Vary
+	w.Header().Add("Vary", "Accept")
+
+	if etag := w.Header().Get("ETag"); etag != "" {
+		if suffix, ok := etagSuffixes[mediaType]; ok {
+			etag = derivedETag(etag, suffix)
+			w.Header().Set("ETag", etag)
+		}
+
+		if status == http.StatusOK && r.Method == http.MethodGet {
+			if header := r.Header.Get("If-None-Match"); header != "" && app.etagMatches(header, etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return nil
+			}
+		}
+	}
+
+	body, err := doc.Marshal(mediaType)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", render.ContentType(mediaType))
 	w.WriteHeader(status)
-	w.Write(js)
+	w.Write(body)
 
 	return nil
 }
 
+// etagMatches 判断If-None-Match请求头中是否包含etag，使用弱比较，忽略弱标签前缀W/
+func (app *application) etagMatches(header, etag string) bool {
+    if strings.TrimSpace(header) == "*" {
+        return true
+    }
+
+    for _, candidate := range strings.Split(header, ",") {
+        candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+        if candidate == strings.TrimPrefix(etag, "W/") {
+            return true
+        }
+    }
+
+    return false
+}
+
+// derivedETag 在强标签etag中加入区分表示的后缀，例如 "1-2" 加上后缀 xml 得到 "1-2-xml"
+func derivedETag(etag string, suffixes ...string) string {
+    if len(suffixes) == 0 {
+        return etag
+    }
+
+    return strings.TrimSuffix(etag, `"`) + "-" + strings.Join(suffixes, "-") + `"`
+}
+
+// projectedETag 把稀疏字段集合并到etag中，同一版本的不同字段集使用不同的强标签
+func projectedETag(etag string, fields []string) string {
+    if len(fields) == 0 {
+        return etag
+    }
+
+    sum := sha256.Sum256([]byte(strings.Join(fields, ",")))
+    return derivedETag(etag, fmt.Sprintf("%x", sum[:4]))
+}
+
+// preconditionMet 检查If-Match请求头，没有该请求头时总是返回true。
+// If-Match使用强比较，弱标签不会匹配。由etag派生的标签(不同的字段集或格式)同样表示客户端看到的是当前版本
+func (app *application) preconditionMet(r *http.Request, etag string) bool {
+    header := r.Header.Get("If-Match")
+    if header == "" || strings.TrimSpace(header) == "*" {
+        return true
+    }
+
+    prefix := strings.TrimSuffix(etag, `"`) + "-"
+
+    for _, candidate := range strings.Split(header, ",") {
+        candidate = strings.TrimSpace(candidate)
+        if candidate == etag || (strings.HasPrefix(candidate, prefix) && strings.HasSuffix(candidate, `"`)) {
+            return true
+        }
+    }
+
+    return false
+}
+
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+// readNamedIDParam 读取路由中指定名称的ID参数，例如 /v1/lists/:id/movies/:movie_id 中的 movie_id
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
@@ -101,6 +211,16 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
     return nil
 }
 
+// contentType 返回请求的媒体类型，忽略charset等参数
+func (app *application) contentType(r *http.Request) string {
+    mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+    if err != nil {
+        return ""
+    }
+
+    return mediaType
+}
+
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
     // 从 URL 查询字符串中获取字符串值
     s := qs.Get(key)
@@ -139,18 +259,62 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
     return i
 }
 
-func (app *application) background(fn func()) {
-    app.wg.Add(1)
-    go func() {
-        defer app.wg.Done()
-        defer func() {
-            if err := recover(); err != nil {
-                // 在这里记录错误信息
-                app.logger.PrintError(fmt.Errorf("%s", err), nil)
+// readFields 解析稀疏字段集参数fields和exclude，exclude会被转换为safelist中剩余的字段
+func (app *application) readFields(qs url.Values, safelist []string, v *validator.Validator) []string {
+    fields := app.readCSV(qs, "fields", []string{})
+    exclude := app.readCSV(qs, "exclude", []string{})
+
+    if len(exclude) == 0 {
+        data.ValidateFields(v, fields, safelist)
+        return fields
+    }
+
+    if len(fields) > 0 {
+        v.AddError("exclude", "must not be used together with fields")
+        return fields
+    }
+
+    return data.ExcludeFields(v, exclude, safelist)
+}
+
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+    s := qs.Get(key)
+
+    if s == "" {
+        return defaultValue
+    }
+
+    b, err := strconv.ParseBool(s)
+    if err != nil {
+        v.AddError(key, "must be a boolean value")
+        return defaultValue
+    }
+
+    return b
+}
+
+// preferredLocale 按照Accept-Language请求头从supported中选择q值最高的语言，只比较主语言标签，
+// 例如zh-CN匹配zh，没有匹配的语言时返回fallback
+func (app *application) preferredLocale(header string, supported []string, fallback string) string {
+    best, bestQ := fallback, 0.0
+
+    for _, part := range strings.Split(header, ",") {
+        tag, params, _ := strings.Cut(part, ";")
+
+        q := 1.0
+        if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+            f, err := strconv.ParseFloat(value, 64)
+            if err != nil {
+                continue
             }
-        }()
+            q = f
+        }
+
+        base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+        if q > bestQ && validator.PermiteedValue(base, supported...) {
+            best, bestQ = base, q
+        }
+    }
 
-        // 调用传入的函数
-        fn()
-    }()
+    return best
 }
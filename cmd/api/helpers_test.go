@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wangyaodream/greenlight/internal/render"
+)
+
+func TestWriteResponseNegotiation(t *testing.T) {
+	tests := []struct {
+		name            string
+		accept          string
+		status          int
+		data            envelope
+		wantStatus      int
+		wantContentType string
+	}{
+		{"no accept", "", http.StatusOK, envelope{"movie": "x"}, http.StatusOK, render.JSON},
+		{"any", "*/*", http.StatusOK, envelope{"movie": "x"}, http.StatusOK, render.JSON},
+		{"application wildcard", "application/*", http.StatusOK, envelope{"movie": "x"}, http.StatusOK, render.JSON},
+		{"xml", "application/xml", http.StatusOK, envelope{"movie": "x"}, http.StatusOK, render.XML},
+		{"csv table", "text/csv", http.StatusOK, envelope{"movies": []any{map[string]any{"id": 1}}}, http.StatusOK, render.CSV},
+		{"csv or any", "text/csv, */*;q=0.1", http.StatusOK, envelope{"movie": "x"}, http.StatusOK, render.JSON},
+		{"csv only", "text/csv", http.StatusOK, envelope{"movie": "x"}, http.StatusNotAcceptable, render.JSON},
+		{"csv only created", "text/csv", http.StatusCreated, envelope{"movie": "x"}, http.StatusNotAcceptable, render.JSON},
+		{"csv only error", "text/csv", http.StatusNotFound, envelope{"error": "x"}, http.StatusNotFound, render.JSON},
+	}
+
+	app := &application{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			if err := app.writeResponse(w, r, tt.status, tt.data, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d; want %d", w.Code, tt.wantStatus)
+			}
+			if got, want := w.Header().Get("Content-Type"), render.ContentType(tt.wantContentType); got != want {
+				t.Errorf("got Content-Type %q; want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wangyaodream/greenlight/internal/data"
+)
+
+// purgeDeletedMovies 在后台定期永久删除超过保留期的软删除电影，服务器关闭时等待当前的清理完成后退出
+func (app *application) purgeDeletedMovies() {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.purge.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-app.shutdown:
+				return
+			case <-ticker.C:
+			}
+
+			n, err := app.models.Movies.PurgeDeleted(app.config.purge.retention)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				continue
+			}
+
+			if n > 0 {
+				app.logger.PrintInfo("purged soft-deleted movies", map[string]any{
+					"count":     n,
+					"retention": app.config.purge.retention.String(),
+				})
+			}
+		}
+	}()
+}
+
+// emailLease 是一次发送尝试的租约，必须大于SMTP的超时时间，租约到期之前其他worker不会重复发送
+const emailLease = time.Minute
+
+// sendEmails 启动发送发件箱邮件的worker，服务器关闭时worker完成当前的邮件后退出
+func (app *application) sendEmails() {
+	for i := 0; i < app.config.email.workers; i++ {
+		app.wg.Add(1)
+
+		go func() {
+			defer app.wg.Done()
+
+			for {
+				wait := time.Duration(0)
+				// 发件箱中没有到期的邮件时等待下一次轮询
+				if !app.sendNextEmail() {
+					wait = app.config.email.pollInterval
+				}
+
+				select {
+				case <-app.shutdown:
+					return
+				case <-time.After(wait):
+				}
+			}
+		}()
+	}
+}
+
+// sendNextEmail 发送一封到期的邮件，没有到期的邮件或者无法读取发件箱时返回false
+func (app *application) sendNextEmail() bool {
+	email, err := app.models.Emails.Claim(emailLease)
+	if err != nil {
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.PrintError(err, nil)
+		}
+		return false
+	}
+
+	properties := map[string]any{
+		"email_id": email.ID,
+		"template": email.Template,
+		"attempts": email.Attempts,
+	}
+
+	sendErr := app.mailer.Send(email.Recipient, email.Locale, email.Template, email.Data)
+	if sendErr == nil {
+		err = app.models.Emails.MarkSent(email.ID)
+		if err != nil {
+			app.logger.PrintError(err, properties)
+		}
+		return true
+	}
+
+	// 超过最大尝试次数之后不再重试，邮件进入dead状态，可以通过接口手动重试
+	var retryAt time.Time
+	if email.Attempts < app.config.email.maxAttempts {
+		retryAt = time.Now().Add(emailBackoff(email.Attempts))
+		properties["retry_at"] = retryAt.Format(time.RFC3339)
+	}
+
+	err = app.models.Emails.MarkFailed(email.ID, sendErr, retryAt)
+	if err != nil {
+		app.logger.PrintError(err, properties)
+	}
+
+	if retryAt.IsZero() {
+		app.logger.PrintError(fmt.Errorf("email marked as dead: %w", sendErr), properties)
+	} else {
+		app.logger.PrintError(fmt.Errorf("email send failed: %w", sendErr), properties)
+	}
+
+	return true
+}
+
+// emailBackoff 返回第attempts次发送失败之后的等待时间，从30秒开始每次翻倍，最长1小时
+func emailBackoff(attempts int) time.Duration {
+	backoff := 30 * time.Second
+
+	for i := 1; i < attempts && backoff < time.Hour; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, time.Hour)
+}
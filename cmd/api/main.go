@@ -3,12 +3,16 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"expvar"
-	"flag"
+	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
 	"runtime"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -20,8 +24,19 @@ import (
 const version = "1.0.0"
 
 type config struct {
+	// configFile和printConfig只在启动时使用，settings记录每一项配置的值和来源
+	configFile  string
+	printConfig bool
+	settings    []setting
+
 	port int
 	env  string
+	// 同时设置了证书和私钥时使用HTTPS，redirectPort不为0时在该端口把HTTP请求重定向到HTTPS
+	tls struct {
+		certFile     string
+		keyFile      string
+		redirectPort int
+	}
 	db   struct {
 		dsn          string
 		maxOpenConns int
@@ -33,6 +48,14 @@ type config struct {
 		burst   int
 		enabled bool
 	}
+	suggestLimiter struct {
+		rps   float64
+		burst int
+	}
+	mailer struct {
+		transport string
+		dir       string
+	}
 	smtp struct {
 		host     string
 		port     int
@@ -43,6 +66,32 @@ type config struct {
     cors struct {
         trustedOrigins []string
     }
+	search struct {
+		config string
+	}
+	purge struct {
+		retention time.Duration
+		interval  time.Duration
+	}
+	email struct {
+		workers      int
+		maxAttempts  int
+		pollInterval time.Duration
+	}
+	log struct {
+		level       jsonlog.Level
+		stackTraces bool
+		// stdoutLevels和fileLevels为空时对应的目标接收所有级别
+		stdoutLevels []jsonlog.Level
+		file         string
+		fileLevels   []jsonlog.Level
+		rotate       jsonlog.RotateOptions
+		sample       struct {
+			interval   time.Duration
+			first      int
+			thereafter int
+		}
+	}
 }
 
 type application struct {
@@ -51,46 +100,66 @@ type application struct {
 	models data.Models
 	mailer mailer.Mailer
     wg sync.WaitGroup
+    // shutdown 在服务器开始关闭时被关闭，通知后台worker退出
+    shutdown chan struct{}
+    // live 是收到SIGHUP时可以替换的配置，请求处理时应该读取这里而不是config中对应的字段
+    live atomic.Pointer[liveConfig]
+    // hangup 接收SIGHUP信号，在main开始时注册，参见reloadOnHangup
+    hangup chan os.Signal
 }
 
 func main() {
-	var cfg config
-
-	// command-line 设定参数
-	flag.IntVar(&cfg.port, "port", 4000, "Server port to listen on")
-	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
-	// database dsn
-    flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
-	// 设定数据库连接池的最大连接数
-	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
-	// 设定数据库连接池的最大空闲连接数
-	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
-	// 设定数据库连接池的最大空闲时间
-	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max idle time")
-
-	// 限流器的设定
-	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
-	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter burst")
-	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", false, "Enable rate limiter")
-    // SMTP
-	flag.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
-	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
-	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("MAIL_USERNAME"), "SMTP username")
-	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("MAIL_PASSWORD"), "SMTP password")
-	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <no-reply@greenlight.wangyaodream.net>", "SMTP sender")
-
-    // CORS
-    flag.Func("cors-trusted-origins", "List of trusted CORS origins", func(val string) error {
-        cfg.cors.trustedOrigins = strings.Fields(val)
-        return nil
-    })
-
-
-
-	flag.Parse()
+	// 最先注册SIGHUP，SIGHUP的默认行为是终止进程，启动时连接数据库等步骤可能比较慢，
+	// 这期间收到的信号会被保留下来，服务器启动之后再重新加载配置
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	// 加载配置，配置有错误时还没有按照配置创建logger，所以使用默认的logger输出错误
+	cfg, err := parseConfig(os.Args[1:], os.Environ())
+	if err != nil {
+		jsonlog.New(os.Stdout, jsonlog.LevelInfo).PrintFatal(err, nil)
+	}
+
+	// 输出配置之前先检查配置，无效的配置项会在输出中标出，并以非零状态退出
+	if cfg.printConfig {
+		errs := validateConfig(cfg)
+		cfg.print(os.Stdout, errs)
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
 
 	// 初始化一个新的logger
-	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+	logger, logFile, err := newLogger(cfg)
+	if err != nil {
+		jsonlog.New(os.Stdout, jsonlog.LevelInfo).PrintFatal(err, nil)
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
+
+	// 标准库和第三方库通过log/slog输出的日志也使用同样的JSON格式
+	slog.SetDefault(slog.New(jsonlog.NewHandler(logger)))
+
+	if errs := validateConfig(cfg); len(errs) > 0 {
+		properties := make(map[string]any, len(errs))
+		for name, message := range errs {
+			properties[name] = message
+		}
+		logger.PrintFatal(errors.New("invalid configuration"), properties)
+	}
+
+	// 启动时解析所有邮件模板，模板有错误时立即退出而不是在发送时才发现
+	templates, err := mailer.LoadTemplates()
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	transport, err := newMailer(cfg, logger, templates)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
 
 	// 建立数据库连接
 	db, err := openDB(cfg)
@@ -119,12 +188,23 @@ func main() {
     }))
 
 	// 实例化一个新的application
+	models := data.NewModels(db)
+	models.Movies.SearchConfig = cfg.search.config
+
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:   cfg,
+		logger:   logger,
+		models:   models,
+		mailer:   transport,
+		shutdown: make(chan struct{}),
+		hangup:   hangup,
 	}
+	app.live.Store(newLiveConfig(cfg))
+
+	// 启动清理软删除电影的后台任务
+	app.purgeDeletedMovies()
+	// 启动发送发件箱邮件的worker
+	app.sendEmails()
 
 	err = app.serve()
 	if err != nil {
@@ -133,6 +213,44 @@ func main() {
 
 }
 
+// newLogger 按照配置创建logger，设置了-log-file时同时返回打开的日志文件，由调用方关闭
+func newLogger(cfg config) (*jsonlog.Logger, *jsonlog.RotatingFile, error) {
+	sinks := []jsonlog.Sink{{Writer: os.Stdout, Levels: cfg.log.stdoutLevels}}
+
+	var logFile *jsonlog.RotatingFile
+
+	if cfg.log.file != "" {
+		var err error
+		logFile, err = jsonlog.OpenRotatingFile(cfg.log.file, cfg.log.rotate)
+		if err != nil {
+			return nil, nil, err
+		}
+		sinks = append(sinks, jsonlog.Sink{Writer: logFile, Levels: cfg.log.fileLevels})
+	}
+
+	logger := jsonlog.NewWithSinks(cfg.log.level, sinks...)
+	logger.SetStackTraces(cfg.log.stackTraces)
+	logger.SetSampling(cfg.log.sample.interval, cfg.log.sample.first, cfg.log.sample.thereafter)
+
+	return logger, logFile, nil
+}
+
+// newMailer 按照-mailer参数创建邮件的发送方式
+func newMailer(cfg config, logger *jsonlog.Logger, templates *mailer.Templates) (mailer.Mailer, error) {
+	switch cfg.mailer.transport {
+	case "smtp":
+		return mailer.NewSMTP(templates, cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender), nil
+	case "file":
+		return mailer.NewFile(templates, cfg.mailer.dir, cfg.smtp.sender)
+	case "log":
+		return mailer.NewLog(templates, logger, cfg.smtp.sender), nil
+	case "memory":
+		return mailer.NewMemory(templates, cfg.smtp.sender), nil
+	default:
+		return nil, fmt.Errorf("invalid -mailer value %q", cfg.mailer.transport)
+	}
+}
+
 func openDB(cfg config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg.db.dsn)
 	if err != nil {
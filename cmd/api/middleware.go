@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/wangyaodream/greenlight/internal/data"
+	"github.com/wangyaodream/greenlight/internal/render"
 	"github.com/wangyaodream/greenlight/internal/validator"
 	"golang.org/x/time/rate"
 )
@@ -63,7 +64,29 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// negotiateContent 在执行处理函数之前检查Accept请求头，客户端不接受任何支持的格式时直接返回406，
+// 避免写操作已经执行却无法返回结果。导出接口和/debug/vars自己决定响应格式，不经过这里的检查
+func (app *application) negotiateContent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/movies/export" && r.URL.Path != "/debug/vars" {
+			if _, ok := render.Negotiate(r.Header.Get("Accept"), render.MediaTypes...); !ok {
+				app.notAcceptableResponse(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit 是全局的限流中间件，所有请求都计入全局限流，标题联想接口在路由上另外使用独立的限流器
 func (app *application) rateLimit(next http.Handler) http.Handler {
+	return app.limitRate(func() rateConfig { return app.live.Load().limiter }, next)
+}
+
+// limitRate 按照客户端IP限制请求频率，每次调用都会创建一组独立的令牌桶。
+// 令牌桶的设置每次请求时由limits读取，重新加载配置后已有客户端的令牌桶也会使用新的设置
+func (app *application) limitRate(limits func() rateConfig, next http.Handler) http.Handler {
 	type client struct {
 		limiter  *rate.Limiter
 		lastSeen time.Time
@@ -99,9 +122,14 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 			return
 		}
 
+		current := limits()
+
 		mu.Lock()
 		if _, found := clients[ip]; !found {
-			clients[ip] = &client{limiter: rate.NewLimiter(2, 4)}
+			clients[ip] = &client{limiter: rate.NewLimiter(rate.Limit(current.rps), current.burst)}
+		} else if limiter := clients[ip].limiter; limiter.Limit() != rate.Limit(current.rps) || limiter.Burst() != current.burst {
+			limiter.SetLimit(rate.Limit(current.rps))
+			limiter.SetBurst(current.burst)
 		}
 
 		// 记录客户端的最后访问时间
@@ -247,10 +275,11 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
         w.Header().Add("Vary", "Access-Control-Request-Method")
 
         origin := r.Header.Get("Origin")
+        trustedOrigins := app.live.Load().trustedOrigins
 
         if origin != "" {
-            for i := range app.config.cors.trustedOrigins {
-                if origin == app.config.cors.trustedOrigins[i] {
+            for i := range trustedOrigins {
+                if origin == trustedOrigins[i] {
                     w.Header().Set("Access-Control-Allow-Origin", origin)
 
                     if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/wangyaodream/greenlight/internal/data"
 	"github.com/wangyaodream/greenlight/internal/validator"
@@ -31,16 +34,23 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		Genres:  input.Genres,
 	}
 
+	// 加载类型分类，用于校验并规范化电影类型
+	genres, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	v := validator.New()
 
 	// 验证
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	// 保存到数据库
-	err = app.models.Movies.Insert(movie)
+	err = app.models.Movies.Insert(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -48,8 +58,9 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", movie.ETag())
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -64,6 +75,14 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	v := validator.New()
+
+	fields := app.readFields(r.URL.Query(), data.MovieFieldSafelist, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// 获取id对应的movie
 	movie, err := app.models.Movies.Get(id)
 	if err != nil {
@@ -76,8 +95,12 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 返回movie
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	// 客户端缓存的版本没有变化时writeResponse返回304，不同的字段集使用不同的ETag
+	headers := make(http.Header)
+	headers.Set("ETag", projectedETag(movie.ETag(), fields))
+
+	// 返回movie，fields和exclude参数可以只返回部分字段
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": movie.Project(fields)}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -102,45 +125,65 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-    // 使用指针类型的结构体，可以判断是否传入了对应的字段，如果没有传入，则不更新
-	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string     `json:"genres"`
-	}
-
-	err = app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	// If-Match 与当前版本不一致时直接返回412，不再尝试更新
+	if !app.preconditionMet(r, movie.ETag()) {
+		app.preconditionFailedResponse(w, r)
 		return
 	}
 
-    if input.Title != nil {
-        movie.Title = *input.Title
-    }
+	// JSON Merge Patch 和 JSON Patch 按照对应的RFC修改movie，其他请求使用部分字段更新
+	switch mediaType := app.contentType(r); mediaType {
+	case "application/merge-patch+json", "application/json-patch+json":
+		if !app.patchMovie(w, r, mediaType, movie) {
+			return
+		}
+	default:
+		// 使用指针类型的结构体，可以判断是否传入了对应的字段，如果没有传入，则不更新
+		var input struct {
+			Title   *string       `json:"title"`
+			Year    *int32        `json:"year"`
+			Runtime *data.Runtime `json:"runtime"`
+			Genres  []string      `json:"genres"`
+		}
 
-    if input.Year != nil {
-        movie.Year = *input.Year
-    }
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
 
-    if input.Runtime != nil {
-        movie.Runtime = *input.Runtime
-    }
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
 
-    if input.Genres != nil {
-        movie.Genres = input.Genres
-    }
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+
+		if input.Runtime != nil {
+			movie.Runtime = *input.Runtime
+		}
+
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
+	}
+
+	genres, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	// 验证
 	v := validator.New()
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	// 更新到数据库
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
 	if err != nil {
         switch {
         case errors.Is(err, data.ErrEditConflict):
@@ -151,8 +194,11 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
         return
 	}
 
+	headers := make(http.Header)
+	headers.Set("ETag", movie.ETag())
+
 	// 返回movie到客户端
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": movie}, headers)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -167,7 +213,91 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	v := validator.New()
+
+	// 默认为软删除，purge=true 时永久删除，需要movies:purge权限
+	purge := app.readBool(r.URL.Query(), "purge", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if purge {
+		permissions, err := app.models.Permissions.GetAllForUser(app.contextGetUser(r).ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include("movies:purge") {
+			app.notPermitedResponse(w, r)
+			return
+		}
+	}
+
+	// 带有If-Match请求头时需要先读取当前版本进行比较，删除时再按照这个版本删除，
+	// 比较之后电影被其他请求修改时同样返回412
+	var version int32
+
+	if r.Header.Get("If-Match") != "" {
+		// 永久删除对软删除的电影同样有效，所以比较版本时也要能读取软删除的电影
+		get := app.models.Movies.Get
+		if purge {
+			get = app.models.Movies.GetIncludingDeleted
+		}
+
+		movie, err := get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !app.preconditionMet(r, movie.ETag()) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+
+		version = movie.Version
+	}
+
+	message := "movie successfully deleted"
+	if purge {
+		err = app.models.Movies.Purge(id, version)
+		message = "movie successfully purged"
+	} else {
+		err = app.models.Movies.Delete(id, version, app.contextGetUser(r).ID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Movies.Restore(id, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -178,7 +308,16 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", movie.ETag())
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -186,8 +325,8 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
     var input struct {
-        Title string
-        Genres []string
+        data.MovieFilter
+        Facets []string
         data.Filters
     }
 
@@ -197,15 +336,36 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
     // 解析查询参数
     qs := r.URL.Query()
 
-    input.Title = app.readString(qs, "title", "")
-    input.Genres = app.readCSV(qs, "genres", []string{})
+    input.MovieFilter = app.readMovieFilter(qs, v)
+
+    // 可选的分面统计，例如 facets=genres,year,decade
+    input.Facets = app.readCSV(qs, "facets", []string{})
 
     input.Filters.Page = app.readInt(qs, "page", 1, v)
     input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 
     input.Filters.Sort = app.readString(qs, "sort", "id")
-    // 指定排序字段,减号字段表示降序
-    input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+    // 指定排序字段,减号字段表示降序，relevance 按照标题的匹配程度从高到低排序
+    input.Filters.SortSafelist = movieSortSafelist
+
+    // 稀疏字段集，例如 fields=id,title 或者 exclude=genres
+    input.Filters.Fields = app.readFields(qs, data.MovieFieldSafelist, v)
+
+    // 传入cursor参数时使用游标分页，cursor为空表示第一页
+    if qs.Has("cursor") {
+        input.Filters.Keyset = true
+
+        if cursor := qs.Get("cursor"); cursor != "" {
+            after, err := data.DecodeCursor(cursor)
+            if err != nil {
+                v.AddError("cursor", "must be a value returned in next_cursor")
+            }
+            input.Filters.After = after
+        }
+    }
+
+    data.ValidateMovieFilter(v, input.MovieFilter)
+    data.ValidateFacets(v, input.Facets)
 
     // 如果有错误，返回错误信息
     if data.ValidateFilters(v, input.Filters); !v.Valid() {
@@ -213,14 +373,119 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
         return
     }
 
-    movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+    err := app.canonicalizeMovieFilter(&input.MovieFilter)
+    if err != nil {
+        app.serverErrorResponse(w, r, err)
+        return
+    }
+
+    movies, metadata, err := app.models.Movies.GetAll(input.MovieFilter, input.Filters)
     if err != nil {
         app.serverErrorResponse(w, r, err)
         return
     }
 
-    err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+    projected := make([]any, len(movies))
+    for i, movie := range movies {
+        projected[i] = movie.Project(input.Filters.Fields)
+    }
+
+    env := envelope{"movies": projected, "metadata": metadata}
+
+    // 只有在请求了分面时才计算并返回facets
+    if len(input.Facets) > 0 {
+        facets, err := app.models.Movies.Facets(input.MovieFilter, input.Facets)
+        if err != nil {
+            app.serverErrorResponse(w, r, err)
+            return
+        }
+        env["facets"] = facets
+    }
+
+    // 列表的ETag由查询参数、每部电影的ID和版本号以及分面统计计算得出
+    headers := make(http.Header)
+    headers.Set("ETag", moviesETag(r.URL.RawQuery, movies, metadata, env["facets"]))
+
+    err = app.writeResponse(w, r, http.StatusOK, env, headers)
     if err != nil {
         app.serverErrorResponse(w, r, err)
     } 
 }
+
+// movieSortSafelist 是电影列表和导出允许的排序字段
+var movieSortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime", "relevance"}
+
+// readMovieFilter 读取电影列表和导出共用的筛选参数
+func (app *application) readMovieFilter(qs url.Values, v *validator.Validator) data.MovieFilter {
+    var filter data.MovieFilter
+
+    filter.Title = app.readString(qs, "title", "")
+    // prefix=true 时把每个词作为前缀匹配，用于输入时的即时搜索
+    filter.Prefix = app.readBool(qs, "prefix", false, v)
+    filter.Genres = app.readCSV(qs, "genres", []string{})
+    filter.GenresAny = app.readCSV(qs, "genres_any", []string{})
+    filter.ExcludeGenres = app.readCSV(qs, "exclude_genres", []string{})
+
+    filter.YearFrom = app.readInt(qs, "year_from", 0, v)
+    filter.YearTo = app.readInt(qs, "year_to", 0, v)
+    filter.RuntimeMin = app.readInt(qs, "runtime_min", 0, v)
+    filter.RuntimeMax = app.readInt(qs, "runtime_max", 0, v)
+
+    return filter
+}
+
+// canonicalizeMovieFilter 把查询参数中的类型按照别名规范化，这样 genres=Sci-Fi 也能匹配 sci-fi
+func (app *application) canonicalizeMovieFilter(filter *data.MovieFilter) error {
+    genres, err := app.models.Genres.Taxonomy()
+    if err != nil {
+        return err
+    }
+
+    filter.Genres = genres.CanonicalAll(filter.Genres)
+    filter.GenresAny = genres.CanonicalAll(filter.GenresAny)
+    filter.ExcludeGenres = genres.CanonicalAll(filter.ExcludeGenres)
+
+    return nil
+}
+
+func (app *application) suggestMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	q := strings.TrimSpace(app.readString(qs, "q", ""))
+	limit := app.readInt(qs, "limit", 10, v)
+
+	v.Check(q != "", "q", "must be provided")
+	v.Check(len(q) <= 100, "q", "must not be more than 100 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 20, "limit", "must be a maximum of 20")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := app.models.Movies.Suggest(q, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// moviesETag 为电影列表生成弱实体标签
+func moviesETag(query string, movies []*data.Movie, metadata data.Metadata, facets any) string {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "%s\n%d\n%v\n", query, metadata.TotalRecords, facets)
+	for _, movie := range movies {
+		fmt.Fprintf(h, "%s\n", movie.ETag())
+	}
+
+	return fmt.Sprintf(`W/"%x"`, h.Sum(nil)[:16])
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/wangyaodream/greenlight/internal/data"
+	"github.com/wangyaodream/greenlight/internal/patch"
+	"github.com/wangyaodream/greenlight/internal/validator"
+)
+
+// movieDocument 是补丁操作的目标文档，只包含可以修改的字段
+type movieDocument struct {
+	Title   string       `json:"title"`
+	Year    int32        `json:"year"`
+	Runtime data.Runtime `json:"runtime"`
+	Genres  []string     `json:"genres"`
+}
+
+// patchMovie 读取JSON Merge Patch或JSON Patch请求体并应用到movie上，
+// 返回false时表示已经向客户端写入了错误响应
+func (app *application) patchMovie(w http.ResponseWriter, r *http.Request, mediaType string, movie *data.Movie) bool {
+	doc, err := toGenericDocument(movieDocument{
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Runtime: movie.Runtime,
+		Genres:  movie.Genres,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	v := validator.New()
+
+	switch mediaType {
+	case "application/merge-patch+json":
+		var mergePatch any
+
+		err = app.readJSON(w, r, &mergePatch)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return false
+		}
+
+		doc = patch.Merge(doc, mergePatch)
+
+	case "application/json-patch+json":
+		var ops []patch.Operation
+
+		err = app.readJSON(w, r, &ops)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return false
+		}
+
+		doc, err = patch.Apply(doc, ops)
+		if err != nil {
+			var patchError *patch.Error
+			if errors.As(err, &patchError) {
+				v.AddError("patch", patchError.Error())
+				app.failedValidationResponse(w, r, v.Errors)
+				return false
+			}
+			app.serverErrorResponse(w, r, err)
+			return false
+		}
+	}
+
+	// 把修改之后的文档解码回movieDocument，未知字段和错误的类型都作为校验错误返回
+	js, err := json.Marshal(doc)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+
+	var patched movieDocument
+
+	err = dec.Decode(&patched)
+	if err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+
+		switch {
+		case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+			v.AddError(unmarshalTypeError.Field, "has an invalid type")
+		case errors.As(err, &unmarshalTypeError):
+			v.AddError("patch", "must produce a JSON object")
+		case errors.Is(err, data.ErrInvalidRuntimeFormat):
+			v.AddError("runtime", "must be in the format \"<n> mins\"")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			v.AddError("patch", "unknown field "+strings.TrimPrefix(err.Error(), "json: unknown field "))
+		default:
+			v.AddError("patch", err.Error())
+		}
+
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	movie.Title = patched.Title
+	movie.Year = patched.Year
+	movie.Runtime = patched.Runtime
+	movie.Genres = patched.Genres
+
+	return true
+}
+
+// toGenericDocument 把结构体转换为map[string]any形式的通用JSON文档
+func toGenericDocument(value any) (any, error) {
+	js, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc any
+	err = json.Unmarshal(js, &doc)
+	return doc, err
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"slices"
+
+	"github.com/wangyaodream/greenlight/internal/jsonlog"
+)
+
+// rateConfig 是一个限流器的令牌桶设置
+type rateConfig struct {
+	rps   float64
+	burst int
+}
+
+// liveConfig 是收到SIGHUP时不需要重启就可以替换的配置，整体通过app.live原子地替换，
+// 所以一个请求读到的配置不会是新旧配置的混合
+type liveConfig struct {
+	trustedOrigins []string
+	limiter        rateConfig
+	suggestLimiter rateConfig
+	logLevel       jsonlog.Level
+}
+
+// liveSettings 是liveConfig中的配置对应的名称，其他配置修改后需要重启才能生效
+var liveSettings = []string{
+	"cors-trusted-origins",
+	"limiter-rps",
+	"limiter-burst",
+	"suggest-limiter-rps",
+	"suggest-limiter-burst",
+	"log-level",
+}
+
+func newLiveConfig(cfg config) *liveConfig {
+	return &liveConfig{
+		trustedOrigins: cfg.cors.trustedOrigins,
+		limiter:        rateConfig{rps: cfg.limiter.rps, burst: cfg.limiter.burst},
+		suggestLimiter: rateConfig{rps: cfg.suggestLimiter.rps, burst: cfg.suggestLimiter.burst},
+		logLevel:       cfg.log.level,
+	}
+}
+
+// reloadOnHangup 在后台等待app.hangup上的SIGHUP信号，每次收到信号时重新加载配置，服务器关闭时退出。
+// 信号在main开始时就已经注册，启动期间收到的信号在这里处理
+func (app *application) reloadOnHangup() {
+	go func() {
+		defer signal.Stop(app.hangup)
+
+		settings := app.config.settings
+
+		for {
+			select {
+			case <-app.hangup:
+				settings = app.reload(settings)
+			case <-app.shutdown:
+				return
+			}
+		}
+	}()
+}
+
+// reload 按照启动时相同的参数重新读取配置文件和环境变量，替换可以热加载的配置并记录修改的内容。
+// 新配置无效时保留当前的配置。返回生效的配置，用于下一次比较
+func (app *application) reload(previous []setting) []setting {
+	cfg, err := parseConfig(os.Args[1:], os.Environ())
+	if err != nil {
+		app.logger.PrintError(err, map[string]any{"action": "reload configuration"})
+		return previous
+	}
+
+	if errs := validateConfig(cfg); len(errs) > 0 {
+		properties := make(map[string]any, len(errs))
+		for name, message := range errs {
+			properties[name] = message
+		}
+		app.logger.PrintError(errors.New("invalid configuration, keeping the current settings"), properties)
+		return previous
+	}
+
+	app.live.Store(newLiveConfig(cfg))
+
+	changed := make(map[string]any)
+	var restartRequired []string
+
+	for i, s := range cfg.settings {
+		// parseConfig每次定义相同的参数，VisitAll按照名称排序，所以两次的settings一一对应
+		old := previous[i]
+		if old.value == s.value {
+			continue
+		}
+
+		if !slices.Contains(liveSettings, s.name) {
+			restartRequired = append(restartRequired, s.name)
+			continue
+		}
+
+		changed[s.name] = map[string]string{
+			"from": redact(s.name, old.value),
+			"to":   redact(s.name, s.value),
+		}
+	}
+
+	properties := map[string]any{"changed": changed}
+	if len(restartRequired) > 0 {
+		properties["restart_required"] = restartRequired
+	}
+
+	// 日志级别变得更详细时先修改级别再输出，变得更简略时输出之后再修改，这样这条日志总是会被输出
+	if cfg.log.level < app.logger.Level() {
+		app.logger.SetLevel(cfg.log.level)
+	}
+	app.logger.PrintInfo("configuration reloaded", properties)
+	app.logger.SetLevel(cfg.log.level)
+
+	// 需要重启的配置没有生效，下一次比较时仍然使用旧的值
+	current := make([]setting, len(cfg.settings))
+	for i, s := range cfg.settings {
+		if slices.Contains(restartRequired, s.name) {
+			s = previous[i]
+		}
+		current[i] = s
+	}
+
+	return current
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/wangyaodream/greenlight/internal/data"
+	"github.com/wangyaodream/greenlight/internal/validator"
+)
+
+func (app *application) listMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// 软删除的电影同样可以查看修改记录，电影被永久删除之后修改记录也会一起删除
+	revisions, err := app.models.Revisions.GetAllForMovie(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if len(revisions) == 0 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"revisions": revisions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revertMovieRevisionHandler 把电影恢复到指定修改之后的状态，恢复本身会作为一次新的修改记录
+func (app *application) revertMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// 版本号是int32，超出范围的版本号不可能存在，不能截断之后再查询
+	rev, err := app.readNamedIDParam(r, "rev")
+	if err != nil || rev > math.MaxInt32 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	revision, err := app.models.Revisions.Get(id, int32(rev))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.preconditionMet(r, movie.ETag()) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	// 删除记录没有修改之后的状态
+	if revision.Current == nil {
+		v.AddError("rev", "cannot revert to a delete revision")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revision.Current.Apply(movie)
+
+	genres, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 与普通更新一样通过version乐观锁写入
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", movie.ETag())
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
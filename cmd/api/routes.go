@@ -20,9 +20,40 @@ func (app *application) routes() http.Handler {
     // 所有/v1/movie**的请求都通过requirePermission中间件
     router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
     router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
-    router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
+    // 批量操作，POST /v1/movies/:id 本身没有对应的处理函数，返回405时和httprouter一样带上Allow响应头
+    router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.staticSegments(map[string]http.Handler{
+        "batch": app.requirePermission("movies:write", app.batchMoviesHandler),
+    }, func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Allow", "GET, PATCH, DELETE, OPTIONS")
+        app.methodNotAllowedResponse(w, r)
+    }))
+    // 标题联想在每次按键时调用，除了全局限流之外还使用独立的限流器
+    suggest := app.limitRate(func() rateConfig { return app.live.Load().suggestLimiter }, app.requirePermission("movies:read", app.suggestMoviesHandler))
+    router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.staticSegments(map[string]http.Handler{
+        "suggest": suggest,
+        "export":  app.requirePermission("movies:export", app.exportMoviesHandler),
+    }, app.requirePermission("movies:read", app.showMovieHandler)))
     router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
     router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+    router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requirePermission("movies:write", app.restoreMovieHandler))
+    router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.requirePermission("movies:read", app.listMovieRevisionsHandler))
+    router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revisions/:rev/revert", app.requirePermission("movies:write", app.revertMovieRevisionHandler))
+
+    router.HandlerFunc(http.MethodGet, "/v1/genres", app.requirePermission("movies:read", app.listGenresHandler))
+
+    // 片单：公开片单允许匿名读取，写操作需要lists:write权限并且只能由所有者执行
+    router.HandlerFunc(http.MethodGet, "/v1/lists", app.listListsHandler)
+    router.HandlerFunc(http.MethodPost, "/v1/lists", app.requirePermission("lists:write", app.createListHandler))
+    router.HandlerFunc(http.MethodGet, "/v1/lists/:id", app.showListHandler)
+    router.HandlerFunc(http.MethodPatch, "/v1/lists/:id", app.requirePermission("lists:write", app.updateListHandler))
+    router.HandlerFunc(http.MethodDelete, "/v1/lists/:id", app.requirePermission("lists:write", app.deleteListHandler))
+    router.HandlerFunc(http.MethodPost, "/v1/lists/:id/movies", app.requirePermission("lists:write", app.addListMovieHandler))
+    router.HandlerFunc(http.MethodPut, "/v1/lists/:id/movies", app.requirePermission("lists:write", app.reorderListMoviesHandler))
+    router.HandlerFunc(http.MethodDelete, "/v1/lists/:id/movies/:movie_id", app.requirePermission("lists:write", app.removeListMovieHandler))
+
+    // 发件箱：查看待发送和发送失败的邮件，手动重试dead状态的邮件
+    router.HandlerFunc(http.MethodGet, "/v1/emails", app.requirePermission("emails:read", app.listEmailsHandler))
+    router.HandlerFunc(http.MethodPost, "/v1/emails/:id/retry", app.requirePermission("emails:write", app.retryEmailHandler))
 
 	// register user
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
@@ -35,6 +66,21 @@ func (app *application) routes() http.Handler {
     router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
     // 添加enbaleCORS中间件
-	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
+	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.negotiateContent(app.authenticate(router))))))
+
+}
+
+// staticSegments 把参数路由中的静态路径段分发给对应的处理函数。
+// httprouter不允许 /v1/movies/suggest 和 /v1/movies/:id 同时注册，所以通过 :id 参数的值来分发
+func (app *application) staticSegments(handlers map[string]http.Handler, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if handler, ok := handlers[params.ByName("id")]; ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
 
+		next.ServeHTTP(w, r)
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -20,6 +21,20 @@ func (app *application) serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	var redirect *http.Server
+
+	if app.config.tls.certFile != "" {
+		tlsConfig, err := app.tlsConfig()
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = tlsConfig
+
+		if app.config.tls.redirectPort != 0 {
+			redirect = app.redirectServer()
+		}
+	}
+
 	// 创建shutdownError channel 用于接收 shutdown() 方法返回的错误
 	shutdownError := make(chan error)
 
@@ -31,7 +46,7 @@ func (app *application) serve() error {
 		// 从channel中读取信号
 		s := <-quit
 
-		app.logger.PrintInfo("shutting down server", map[string]string{
+		app.logger.PrintInfo("shutting down server", map[string]any{
 			"signal": s.String(),
 		})
 
@@ -40,26 +55,59 @@ func (app *application) serve() error {
 		defer cancel()
 
 
+        if redirect != nil {
+            err := redirect.Shutdown(ctx)
+            if err != nil {
+                app.logger.PrintError(err, map[string]any{"addr": redirect.Addr})
+            }
+        }
+
         err := srv.Shutdown(ctx)
         if err != nil {
             shutdownError <- err
         }
 
         // 发送log信息说明正在等待后台任务完成
-        app.logger.PrintInfo("completing background tasks", map[string]string{
+        app.logger.PrintInfo("completing background tasks", map[string]any{
             "addr": srv.Addr,
         })
+        close(app.shutdown)
         app.wg.Wait()
 
 		shutdownError <- srv.Shutdown(ctx)
 	}()
 
-	app.logger.PrintInfo("starting server", map[string]string{
+	// 收到SIGHUP时重新加载配置，不需要重启监听的端口
+	app.reloadOnHangup()
+
+	// 先监听重定向的端口，端口被占用时启动失败而不是在后台出错
+	if redirect != nil {
+		ln, err := net.Listen("tcp", redirect.Addr)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			err := redirect.Serve(ln)
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.PrintError(err, map[string]any{"addr": redirect.Addr})
+			}
+		}()
+	}
+
+	app.logger.PrintInfo("starting server", map[string]any{
 		"addr": srv.Addr,
 		"env":  app.config.env,
+		"tls":  srv.TLSConfig != nil,
 	})
 
-	err := srv.ListenAndServe()
+	var err error
+	if srv.TLSConfig != nil {
+		// 证书由TLSConfig.GetCertificate提供，所以不需要传入文件名
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
@@ -70,7 +118,7 @@ func (app *application) serve() error {
 		return err
 	}
 
-	app.logger.PrintInfo("stopped server", map[string]string{
+	app.logger.PrintInfo("stopped server", map[string]any{
 		"addr": srv.Addr,
 	})
 	return nil
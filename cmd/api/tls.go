@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// certCheckInterval 是检查证书文件是否被替换的最小间隔
+const certCheckInterval = 10 * time.Second
+
+// certReloader 在TLS握手时提供证书，证书或私钥文件的修改时间或大小变化后重新加载，
+// 所以证书轮换之后不需要重启服务器。新文件无法加载时继续使用旧的证书
+type certReloader struct {
+	app      *application
+	certFile string
+	keyFile  string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	files     [2]fileState
+	checkedAt time.Time
+}
+
+// fileState 是用来判断文件是否被替换的状态。替换后的文件可能保留了原来的修改时间，
+// 或者修改时间早于旧文件(例如从备份中恢复)，所以只要和上一次不同就重新加载
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func newCertReloader(app *application, certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{app: app, certFile: certFile, keyFile: keyFile}
+
+	files, err := c.stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.load(files); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// stat 返回证书和私钥文件当前的状态
+func (c *certReloader) stat() ([2]fileState, error) {
+	var files [2]fileState
+
+	for i, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return files, err
+		}
+		files[i] = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	return files, nil
+}
+
+func (c *certReloader) load(files [2]fileState) error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.cert = &cert
+	c.files = files
+
+	return nil
+}
+
+// changed 判断文件状态是否和上一次加载时不同，使用Equal比较时间，不受单调时钟读数的影响
+func (c *certReloader) changed(files [2]fileState) bool {
+	for i := range files {
+		if !files[i].modTime.Equal(c.files[i].modTime) || files[i].size != c.files[i].size {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getCertificate 实现tls.Config.GetCertificate，每certCheckInterval最多检查一次文件
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checkedAt) < certCheckInterval {
+		return c.cert, nil
+	}
+	c.checkedAt = time.Now()
+
+	files, err := c.stat()
+	if err != nil {
+		c.app.logger.PrintError(err, map[string]any{"action": "reload certificate"})
+		return c.cert, nil
+	}
+
+	if !c.changed(files) {
+		return c.cert, nil
+	}
+
+	// 证书和私钥可能没有同时写完，加载失败时下一次检查会再次尝试
+	if err := c.load(files); err != nil {
+		c.app.logger.PrintError(err, map[string]any{"action": "reload certificate"})
+		return c.cert, nil
+	}
+
+	c.app.logger.PrintInfo("certificate reloaded", map[string]any{
+		"cert": c.certFile,
+	})
+
+	return c.cert, nil
+}
+
+// tlsConfig 返回只允许TLS 1.2及以上版本和前向安全的AEAD加密套件的配置，同时支持HTTP/2
+func (app *application) tlsConfig() (*tls.Config, error) {
+	certs, err := newCertReloader(app, app.config.tls.certFile, app.config.tls.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		// TLS 1.3的加密套件不能配置，这里只限制TLS 1.2使用的套件
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: certs.getCertificate,
+	}, nil
+}
+
+// redirectServer 返回把所有HTTP请求永久重定向到HTTPS端口的服务器
+func (app *application) redirectServer() *http.Server {
+	return &http.Server{
+		Addr: fmt.Sprintf(":%d", app.config.tls.redirectPort),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				host = r.Host
+			}
+
+			if app.config.port != 443 {
+				host = net.JoinHostPort(host, strconv.Itoa(app.config.port))
+			}
+
+			// 308会保留请求的方法和请求体
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+		}),
+		IdleTimeout:       time.Minute,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
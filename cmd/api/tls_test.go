@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wangyaodream/greenlight/internal/jsonlog"
+)
+
+func TestCertReloaderOlderModTime(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	writeKeyPair(t, certFile, keyFile, "first")
+
+	app := &application{logger: jsonlog.New(io.Discard, jsonlog.LevelInfo)}
+
+	c, err := newCertReloader(app, certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 新的证书保留了比旧证书更早的修改时间，例如从备份中恢复或者使用cp -p复制
+	writeKeyPair(t, certFile, keyFile, "second")
+	older := time.Now().Add(-24 * time.Hour)
+	for _, name := range []string{certFile, keyFile} {
+		if err := os.Chtimes(name, older, older); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.checkedAt = time.Time{}
+
+	cert, err := c.getCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if leaf.Subject.CommonName != "second" {
+		t.Errorf("got certificate %q; want %q", leaf.Subject.CommonName, "second")
+	}
+
+	// 文件没有变化时继续使用已经加载的证书
+	c.checkedAt = time.Time{}
+	again, err := c.getCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Certificate[0], cert.Certificate[0]) {
+		t.Error("certificate was reloaded although the files did not change")
+	}
+}
+
+func writeKeyPair(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -66,7 +66,7 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	}
 
 	// 将token实例编码为JSON
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"authentication_token": token}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -14,6 +14,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Name     string `json:"name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Locale   string `json:"locale"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -22,10 +23,16 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// 没有指定语言时按照Accept-Language请求头选择
+	if input.Locale == "" {
+		input.Locale = app.preferredLocale(r.Header.Get("Accept-Language"), data.LocaleSafelist, data.DefaultLocale)
+	}
+
 	user := &data.User{
 		Name:      input.Name,
 		Email:     input.Email,
 		Activated: false,
+		Locale:    input.Locale,
 	}
 
 	err = user.Password.Set(input.Password)
@@ -41,8 +48,35 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// 插入数据到数据库
-	err = app.models.Users.Insert(user)
+	// 用户、权限、激活令牌和激活邮件在同一个事务中写入，任意一步失败时都不会留下无法激活的用户
+	err = app.models.InTx(func(models data.Models) error {
+		err := models.Users.Insert(user)
+		if err != nil {
+			return err
+		}
+
+		// 添加"movies:read"权限
+		err = models.Permissions.AddForUser(user.ID, "movies:read")
+		if err != nil {
+			return err
+		}
+
+		token, err := models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			return err
+		}
+
+		// 激活邮件写入发件箱，由后台worker在事务提交后发送，发送失败时会自动重试
+		return models.Emails.Insert(&data.Email{
+			Recipient: user.Email,
+			Locale:    user.Locale,
+			Template:  "user_welcome.tmpl",
+			Data: map[string]any{
+				"activationToken": token.Plaintext,
+				"userID":          user.ID,
+			},
+		})
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
@@ -54,34 +88,8 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-    // 添加"movies:read"权限
-    err = app.models.Permissions.AddForUser(user.ID, "movies:read")
-    if err != nil {
-        app.serverErrorResponse(w, r, err)
-        return
-    }
-
-    token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
-    if err != nil {
-        app.serverErrorResponse(w, r, err)
-        return
-    }
-
-    app.background(func() {
-        data := map[string]any{
-            "activationToken": token.Plaintext,
-            "userID": user.ID,
-        }
-
-        err = app.mailer.Send(user.Email, "user_welcome.tmpl", data)
-        if err != nil {
-            app.logger.PrintError(err, nil)
-        }
-    })
-
-
 	// 写入JSON
-	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user}, nil)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -141,7 +149,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
         return
     }
 
-    err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+    err = app.writeResponse(w, r, http.StatusOK, envelope{"user": user}, nil)
     if err != nil {
         app.serverErrorResponse(w, r, err)
     }
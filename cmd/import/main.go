@@ -0,0 +1,276 @@
+// import 从CSV或NDJSON文件批量导入电影。
+// 每一行都会使用与API相同的规则校验，已有电影按照title和year匹配并更新，
+// 最后输出接受、跳过和拒绝的行数以及原因
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/wangyaodream/greenlight/internal/data"
+	"github.com/wangyaodream/greenlight/internal/jsonlog"
+	"github.com/wangyaodream/greenlight/internal/validator"
+)
+
+type config struct {
+	dsn       string
+	file      string
+	format    string
+	columns   string
+	batchSize int
+	dryRun    bool
+}
+
+// outcome 记录一行没有被接受的原因
+type outcome struct {
+	line     int
+	rejected bool
+	reason   string
+}
+
+type summary struct {
+	inserted int
+	updated  int
+	outcomes []outcome
+}
+
+func (s *summary) skip(line int, reason string) {
+	s.outcomes = append(s.outcomes, outcome{line: line, reason: reason})
+}
+
+func (s *summary) reject(line int, reason string) {
+	s.outcomes = append(s.outcomes, outcome{line: line, rejected: true, reason: reason})
+}
+
+func main() {
+	var cfg config
+
+	flag.StringVar(&cfg.dsn, "db-dsn", "", "PostgreSQL DSN")
+	flag.StringVar(&cfg.file, "file", "", "File to import, - reads from standard input")
+	flag.StringVar(&cfg.format, "format", "", "Input format (csv|ndjson), detected from the file extension when empty")
+	flag.StringVar(&cfg.columns, "columns", "", "Column mapping overrides, e.g. title=Name,runtime=Length")
+	flag.IntVar(&cfg.batchSize, "batch-size", 500, "Number of movies written per statement")
+	flag.BoolVar(&cfg.dryRun, "dry-run", false, "Validate the file without writing to the database")
+
+	flag.Parse()
+
+	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+
+	if cfg.file == "" {
+		logger.PrintFatal(errors.New("-file must be provided"), nil)
+	}
+
+	if cfg.batchSize < 1 || cfg.batchSize > 5000 {
+		logger.PrintFatal(errors.New("-batch-size must be between 1 and 5000"), nil)
+	}
+
+	if cfg.format == "" {
+		cfg.format = strings.TrimPrefix(strings.ToLower(filepath.Ext(cfg.file)), ".")
+	}
+
+	columns, err := newColumnMap(cfg.columns)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	var input io.Reader = os.Stdin
+	if cfg.file != "-" {
+		f, err := os.Open(cfg.file)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	var src source
+
+	switch cfg.format {
+	case "csv":
+		src, err = newCSVSource(input, columns)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	case "ndjson", "jsonl":
+		src = newNDJSONSource(input, columns)
+	default:
+		logger.PrintFatal(fmt.Errorf("unsupported format %q, use -format=csv or -format=ndjson", cfg.format), nil)
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	defer db.Close()
+
+	models := data.NewModels(db)
+
+	genres, err := models.Genres.Taxonomy()
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	result, err := importMovies(models.Movies, genres, src, cfg)
+	if err != nil {
+		logger.PrintFatal(err, map[string]any{
+			"imported": result.inserted + result.updated,
+		})
+	}
+
+	result.print(os.Stdout, cfg.dryRun)
+}
+
+// importMovies 读取全部行，校验通过的电影每batchSize条写入一次，每一批在同一条语句中原子地写入
+func importMovies(movies data.MovieModel, genres *data.GenreTaxonomy, src source, cfg config) (*summary, error) {
+	result := &summary{}
+
+	type key struct {
+		title string
+		year  int32
+	}
+
+	// 文件中title和year相同的电影只导入第一次出现的那一行
+	seen := make(map[key]int)
+
+	var (
+		batch []*data.Movie
+		lines []int
+	)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if !cfg.dryRun {
+			inserted, updated, err := movies.Upsert(batch)
+			if err != nil {
+				return err
+			}
+			result.inserted += inserted
+			result.updated += updated
+
+			for i, movie := range batch {
+				if movie.ID == 0 {
+					result.skip(lines[i], "unchanged")
+				}
+			}
+		} else {
+			result.inserted += len(batch)
+		}
+
+		batch, lines = batch[:0], lines[:0]
+		return nil
+	}
+
+	for {
+		r, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+
+		if r.err != nil {
+			result.reject(r.line, r.err.Error())
+			continue
+		}
+
+		v := validator.New()
+		if data.ValidateMovie(v, r.movie, genres); !v.Valid() {
+			result.reject(r.line, validationReason(v.Errors))
+			continue
+		}
+
+		k := key{r.movie.Title, r.movie.Year}
+		if first, ok := seen[k]; ok {
+			result.skip(r.line, fmt.Sprintf("duplicate of line %d", first))
+			continue
+		}
+		seen[k] = r.line
+
+		batch = append(batch, r.movie)
+		lines = append(lines, r.line)
+
+		if len(batch) == cfg.batchSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, flush()
+}
+
+func validationReason(errs map[string]string) string {
+	keys := make([]string, 0, len(errs))
+	for key := range errs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	reasons := make([]string, len(keys))
+	for i, key := range keys {
+		reasons[i] = key + ": " + errs[key]
+	}
+
+	return strings.Join(reasons, "; ")
+}
+
+func (s *summary) print(w io.Writer, dryRun bool) {
+	skipped, rejected := 0, 0
+	for _, o := range s.outcomes {
+		if o.rejected {
+			rejected++
+		} else {
+			skipped++
+		}
+	}
+
+	if dryRun {
+		fmt.Fprintf(w, "accepted: %d (dry run, nothing written)\n", s.inserted)
+	} else {
+		fmt.Fprintf(w, "accepted: %d (inserted %d, updated %d)\n", s.inserted+s.updated, s.inserted, s.updated)
+	}
+	fmt.Fprintf(w, "skipped:  %d\n", skipped)
+	fmt.Fprintf(w, "rejected: %d\n", rejected)
+
+	sort.SliceStable(s.outcomes, func(i, j int) bool {
+		return s.outcomes[i].line < s.outcomes[j].line
+	})
+
+	for _, o := range s.outcomes {
+		status := "skipped"
+		if o.rejected {
+			status = "rejected"
+		}
+		fmt.Fprintf(w, "line %d: %s: %s\n", o.line, status, o.reason)
+	}
+}
+
+func openDB(cfg config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/wangyaodream/greenlight/internal/data"
+)
+
+func TestImportMoviesDryRun(t *testing.T) {
+	input := `title,year,runtime,genres
+Casablanca,1942,102,Drama
+Casablanca,1942,103,drama
+No Genres,2000,90,
+Unknown Genre,2001,90,western
+Bad Year,19x9,90,drama
+Alien,1979,117,horror|sci-fi
+`
+
+	src, err := newCSVSource(strings.NewReader(input), mustColumnMap(t, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genres := data.NewGenreTaxonomy(map[string]string{
+		"drama":  "drama",
+		"horror": "horror",
+		"sci-fi": "sci-fi",
+	})
+
+	result, err := importMovies(data.MovieModel{}, genres, src, config{batchSize: 2, dryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	result.print(&buf, true)
+
+	want := `accepted: 2 (dry run, nothing written)
+skipped:  1
+rejected: 3
+line 3: skipped: duplicate of line 2
+line 4: rejected: genres: must contain at least 1 genre
+line 5: rejected: genres: contains unknown genre "western"
+line 6: rejected: year: must be an integer
+`
+
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
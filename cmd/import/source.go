@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/wangyaodream/greenlight/internal/data"
+)
+
+// movieFields 是可以导入的字段
+var movieFields = []string{"title", "year", "runtime", "genres"}
+
+// defaultColumns 是每个字段默认可以匹配的列名(小写)
+var defaultColumns = map[string][]string{
+	"title":   {"title", "name", "primary_title", "primarytitle"},
+	"year":    {"year", "release_year", "startyear"},
+	"runtime": {"runtime", "runtime_minutes", "runtimeminutes", "duration"},
+	"genres":  {"genres", "genre"},
+}
+
+// columnMap 保存小写列名到字段的映射
+type columnMap map[string]string
+
+// newColumnMap 使用默认列名创建映射，overrides形如"title=Name,runtime=Length"，
+// 指定的列名会替换该字段所有的默认列名
+func newColumnMap(overrides string) (columnMap, error) {
+	columns := make(map[string][]string, len(defaultColumns))
+	for field, names := range defaultColumns {
+		columns[field] = names
+	}
+
+	for _, pair := range strings.Split(overrides, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		field, column, ok := strings.Cut(pair, "=")
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !ok || strings.TrimSpace(column) == "" {
+			return nil, fmt.Errorf("invalid column mapping %q", pair)
+		}
+
+		if _, ok := defaultColumns[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q in column mapping", field)
+		}
+
+		columns[field] = []string{strings.ToLower(strings.TrimSpace(column))}
+	}
+
+	m := make(columnMap)
+	for field, names := range columns {
+		for _, name := range names {
+			m[name] = field
+		}
+	}
+
+	return m, nil
+}
+
+func (m columnMap) field(column string) (string, bool) {
+	field, ok := m[strings.ToLower(strings.TrimSpace(column))]
+	return field, ok
+}
+
+// row 是导入文件中的一行，err不为nil时表示这一行无法解析
+type row struct {
+	line  int
+	movie *data.Movie
+	err   error
+}
+
+// source 逐行读取导入文件，读取完毕时返回io.EOF
+type source interface {
+	Next() (row, error)
+}
+
+type csvSource struct {
+	reader  *csv.Reader
+	columns map[int]string
+}
+
+// newCSVSource 读取表头并确定每一列对应的字段，表头必须包含所有字段
+func newCSVSource(r io.Reader, m columnMap) (*csvSource, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+
+	columns := make(map[int]string)
+	found := make(map[string]bool)
+
+	for i, name := range header {
+		if field, ok := m.field(name); ok && !found[field] {
+			columns[i] = field
+			found[field] = true
+		}
+	}
+
+	for _, field := range movieFields {
+		if !found[field] {
+			return nil, fmt.Errorf("no CSV column maps to the %s field", field)
+		}
+	}
+
+	return &csvSource{reader: reader, columns: columns}, nil
+}
+
+func (s *csvSource) Next() (row, error) {
+	record, err := s.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return row{line: parseErr.StartLine, err: parseErr.Err}, nil
+		}
+		return row{}, err
+	}
+
+	line, _ := s.reader.FieldPos(0)
+
+	movie := &data.Movie{}
+	var errs []string
+
+	for i, value := range record {
+		field, ok := s.columns[i]
+		if !ok {
+			continue
+		}
+
+		if err := setField(movie, field, value); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return row{line: line, err: errors.New(strings.Join(errs, "; "))}, nil
+	}
+
+	return row{line: line, movie: movie}, nil
+}
+
+// setField 把文本值写入movie的字段，genres使用逗号或者竖线分隔
+func setField(movie *data.Movie, field, value string) error {
+	value = strings.TrimSpace(value)
+
+	switch field {
+	case "title":
+		movie.Title = value
+
+	case "year":
+		if value == "" {
+			return nil
+		}
+		year, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return errors.New("year: must be an integer")
+		}
+		movie.Year = int32(year)
+
+	case "runtime":
+		if value == "" {
+			return nil
+		}
+		runtime, err := data.ParseRuntime(value)
+		if err != nil {
+			return fmt.Errorf("runtime: %w", err)
+		}
+		movie.Runtime = runtime
+
+	case "genres":
+		movie.Genres = strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || r == '|'
+		})
+		for i := range movie.Genres {
+			movie.Genres[i] = strings.TrimSpace(movie.Genres[i])
+		}
+	}
+
+	return nil
+}
+
+type ndjsonSource struct {
+	scanner *bufio.Scanner
+	columns columnMap
+	line    int
+}
+
+func newNDJSONSource(r io.Reader, m columnMap) *ndjsonSource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1_048_576)
+
+	return &ndjsonSource{scanner: scanner, columns: m}
+}
+
+func (s *ndjsonSource) Next() (row, error) {
+	for s.scanner.Scan() {
+		s.line++
+
+		text := strings.TrimSpace(s.scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(text), &object); err != nil {
+			return row{line: s.line, err: errors.New("line is not a JSON object")}, nil
+		}
+
+		movie := &data.Movie{}
+		var errs []string
+
+		for key, raw := range object {
+			field, ok := s.columns.field(key)
+			if !ok {
+				continue
+			}
+
+			if err := setJSONField(movie, field, raw); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+
+		if len(errs) > 0 {
+			return row{line: s.line, err: errors.New(strings.Join(errs, "; "))}, nil
+		}
+
+		return row{line: s.line, movie: movie}, nil
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		return row{}, err
+	}
+
+	return row{}, io.EOF
+}
+
+// setJSONField 把JSON值写入movie的字段，数字原样转换为文本后交给setField。
+// genres可以是字符串数组，数组中的每个元素就是一个类型，不会再按照逗号或者竖线拆分
+func setJSONField(movie *data.Movie, field string, raw json.RawMessage) error {
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return setField(movie, field, "")
+	case string:
+		return setField(movie, field, v)
+	case float64:
+		return setField(movie, field, strconv.FormatFloat(v, 'f', -1, 64))
+	case []any:
+		if field != "genres" {
+			break
+		}
+		genres := make([]string, 0, len(v))
+		for _, item := range v {
+			genre, ok := item.(string)
+			if !ok {
+				return errors.New("genres: must be an array of strings")
+			}
+			if genre = strings.TrimSpace(genre); genre != "" {
+				genres = append(genres, genre)
+			}
+		}
+		movie.Genres = genres
+		return nil
+	}
+
+	return fmt.Errorf("%s: unsupported JSON value", field)
+}
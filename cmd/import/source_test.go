@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wangyaodream/greenlight/internal/data"
+)
+
+// readAll 读取source中的所有行
+func readAll(t *testing.T, src source) []row {
+	t.Helper()
+
+	var rows []row
+	for {
+		r, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			return rows
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, r)
+	}
+}
+
+func mustColumnMap(t *testing.T, overrides string) columnMap {
+	t.Helper()
+
+	m, err := newColumnMap(overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestCSVSource(t *testing.T) {
+	input := `Title,Year,Runtime,Genres,Rating
+Casablanca,1942,102 mins,"drama, romance",8.5
+"Quoted, Title",1999,136,action|sci-fi,
+Bad Year,19x9,90,drama,
+Bad Runtime,2000,ninety,drama,
+Empty,,,,
+`
+
+	src, err := newCSVSource(strings.NewReader(input), mustColumnMap(t, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := readAll(t, src)
+	if len(rows) != 5 {
+		t.Fatalf("got %d rows; want 5", len(rows))
+	}
+
+	want := []*data.Movie{
+		{Title: "Casablanca", Year: 1942, Runtime: 102, Genres: []string{"drama", "romance"}},
+		{Title: "Quoted, Title", Year: 1999, Runtime: 136, Genres: []string{"action", "sci-fi"}},
+	}
+	for i, movie := range want {
+		if rows[i].err != nil {
+			t.Fatalf("row %d: %v", i, rows[i].err)
+		}
+		if !reflect.DeepEqual(rows[i].movie, movie) {
+			t.Errorf("row %d: got %+v; want %+v", i, rows[i].movie, movie)
+		}
+	}
+
+	// 行号是文件中的行号，表头是第1行
+	for i, line := range []int{2, 3, 4, 5, 6} {
+		if rows[i].line != line {
+			t.Errorf("row %d: got line %d; want %d", i, rows[i].line, line)
+		}
+	}
+
+	if rows[2].err == nil || rows[2].err.Error() != "year: must be an integer" {
+		t.Errorf("got error %v for an invalid year", rows[2].err)
+	}
+	if rows[3].err == nil || rows[3].err.Error() != "runtime: invalid runtime format" {
+		t.Errorf("got error %v for an invalid runtime", rows[3].err)
+	}
+
+	// 空值保留零值，由校验拒绝
+	if empty := rows[4].movie; empty == nil || empty.Year != 0 || empty.Runtime != 0 || len(empty.Genres) != 0 {
+		t.Errorf("got %+v for an empty row", rows[4].movie)
+	}
+}
+
+func TestCSVSourceColumns(t *testing.T) {
+	input := "Name,Released,Length,Kind\nAlien,1979,117,horror\n"
+
+	if _, err := newCSVSource(strings.NewReader(input), mustColumnMap(t, "")); err == nil {
+		t.Fatal("expected an error when no column maps to year")
+	}
+
+	src, err := newCSVSource(strings.NewReader(input), mustColumnMap(t, "year=Released,runtime=length,genres=KIND"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := readAll(t, src)
+	want := &data.Movie{Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"horror"}}
+	if len(rows) != 1 || !reflect.DeepEqual(rows[0].movie, want) {
+		t.Errorf("got %+v; want %+v", rows, want)
+	}
+}
+
+func TestCSVSourceParseError(t *testing.T) {
+	input := "title,year,runtime,genres\n\"unterminated,1999,90,drama\n"
+
+	src, err := newCSVSource(strings.NewReader(input), mustColumnMap(t, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := readAll(t, src)
+	if len(rows) != 1 || rows[0].err == nil || rows[0].line != 2 {
+		t.Errorf("got %+v; want one rejected row on line 2", rows)
+	}
+}
+
+func TestNewColumnMapErrors(t *testing.T) {
+	for _, overrides := range []string{"title", "title=", "rating=Score"} {
+		if _, err := newColumnMap(overrides); err == nil {
+			t.Errorf("newColumnMap(%q): expected an error", overrides)
+		}
+	}
+}
+
+func TestNDJSONSource(t *testing.T) {
+	input := `{"title":"Casablanca","year":1942,"runtime":"102 mins","genres":["drama","romance"]}
+
+{"title":"Comma Genre","year":2001,"runtime":90,"genres":["sci-fi, fantasy"," drama ",""]}
+{"title":"String Genres","year":"2002","runtime":null,"genres":"action|comedy"}
+not json
+{"title":"Bad Genres","year":2003,"runtime":90,"genres":[1]}
+{"title":"Fractional","year":2004.5,"runtime":1.5,"genres":["drama"]}
+{"title":["array"],"year":2005,"runtime":90,"genres":["drama"]}
+`
+
+	rows := readAll(t, newNDJSONSource(strings.NewReader(input), mustColumnMap(t, "")))
+	if len(rows) != 7 {
+		t.Fatalf("got %d rows; want 7", len(rows))
+	}
+
+	// 空行不产生记录，但是计入行号
+	lines := []int{1, 3, 4, 5, 6, 7, 8}
+	for i, line := range lines {
+		if rows[i].line != line {
+			t.Errorf("row %d: got line %d; want %d", i, rows[i].line, line)
+		}
+	}
+
+	want := []*data.Movie{
+		{Title: "Casablanca", Year: 1942, Runtime: 102, Genres: []string{"drama", "romance"}},
+		// 数组中的元素不会按照逗号拆分
+		{Title: "Comma Genre", Year: 2001, Runtime: 90, Genres: []string{"sci-fi, fantasy", "drama"}},
+		{Title: "String Genres", Year: 2002, Genres: []string{"action", "comedy"}},
+	}
+	for i, movie := range want {
+		if rows[i].err != nil {
+			t.Fatalf("row %d: %v", i, rows[i].err)
+		}
+		if !reflect.DeepEqual(rows[i].movie, movie) {
+			t.Errorf("row %d: got %+v; want %+v", i, rows[i].movie, movie)
+		}
+	}
+
+	wantErrs := map[int]string{
+		3: "line is not a JSON object",
+		4: "genres: must be an array of strings",
+		6: "title: unsupported JSON value",
+	}
+	for i, want := range wantErrs {
+		if rows[i].err == nil || rows[i].err.Error() != want {
+			t.Errorf("row %d: got error %v; want %q", i, rows[i].err, want)
+		}
+	}
+
+	// 小数的年份和时长都会被拒绝，两个错误合并在一起
+	if err := rows[5].err; err == nil || err.Error() != "year: must be an integer; runtime: invalid runtime format" {
+		t.Errorf("row 5: got error %v", err)
+	}
+}
@@ -0,0 +1,321 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 发件箱中邮件的状态
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailDead    = "dead"
+)
+
+var EmailStatusSafelist = []string{EmailPending, EmailSent, EmailDead}
+
+// Email 是发件箱中的一封邮件，Data是渲染模板使用的数据，可能包含激活令牌，所以不会输出
+type Email struct {
+	ID            int64          `json:"id"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Recipient     string         `json:"recipient"`
+	Locale        string         `json:"locale"`
+	Template      string         `json:"template"`
+	Data          map[string]any `json:"-"`
+	Status        string         `json:"status"`
+	Attempts      int            `json:"attempts"`
+	NextAttemptAt time.Time      `json:"next_attempt_at"`
+	LastError     string         `json:"last_error,omitempty"`
+	SentAt        *time.Time     `json:"sent_at,omitempty"`
+}
+
+type EmailModel struct {
+	DB *sql.DB
+
+	// tx 不为nil时所有操作都在该事务中执行，参见Models.InTx
+	tx *sql.Tx
+}
+
+func (m EmailModel) db() queryer {
+	if m.tx != nil {
+		return m.tx
+	}
+
+	return m.DB
+}
+
+// Insert 把邮件加入发件箱，邮件会由后台worker尽快发送
+func (m EmailModel) Insert(email *Email) error {
+	data, err := json.Marshal(email.Data)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO emails (recipient, locale, template, data)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at, status, next_attempt_at
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.db().QueryRowContext(ctx, query, email.Recipient, email.Locale, email.Template, data).Scan(
+		&email.ID,
+		&email.CreatedAt,
+		&email.Status,
+		&email.NextAttemptAt,
+	)
+}
+
+// Claim 取出一封到期的待发送邮件，增加尝试次数并把下一次尝试时间推迟lease。
+// 推迟的时间相当于租约，发送过程中进程退出时，租约到期后邮件会被其他worker重新发送。
+// 没有到期的邮件时返回ErrRecordNotFound
+func (m EmailModel) Claim(lease time.Duration) (*Email, error) {
+	query := `
+        UPDATE emails
+        SET attempts = attempts + 1, next_attempt_at = NOW() + $1 * interval '1 second'
+        WHERE id = (
+            SELECT id
+            FROM emails
+            WHERE status = 'pending' AND next_attempt_at <= NOW()
+            ORDER BY next_attempt_at ASC, id ASC
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, created_at, recipient, locale, template, data, status, attempts, next_attempt_at, last_error
+    `
+
+	var (
+		email Email
+		data  []byte
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.db().QueryRowContext(ctx, query, lease.Seconds()).Scan(
+		&email.ID,
+		&email.CreatedAt,
+		&email.Recipient,
+		&email.Locale,
+		&email.Template,
+		&data,
+		&email.Status,
+		&email.Attempts,
+		&email.NextAttemptAt,
+		&email.LastError,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	// 使用json.Number解码数字，否则较大的ID在模板中会被渲染为1.234567e+06这样的科学计数法
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	err = dec.Decode(&email.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &email, nil
+}
+
+// MarkSent 记录邮件已经发送，同时清空模板数据，避免令牌长期保存在数据库中
+func (m EmailModel) MarkSent(id int64) error {
+	query := `
+        UPDATE emails
+        SET status = 'sent', sent_at = NOW(), last_error = '', data = '{}'
+        WHERE id = $1
+    `
+
+	return m.execOne(query, id)
+}
+
+// MarkFailed 记录发送失败的原因，retryAt为零值时邮件进入dead状态，不再自动重试。
+// dead状态的邮件保留模板数据，以便通过Retry重新发送，发送成功后由MarkSent清空
+func (m EmailModel) MarkFailed(id int64, sendErr error, retryAt time.Time) error {
+	if retryAt.IsZero() {
+		query := `
+            UPDATE emails
+            SET status = 'dead', last_error = $2
+            WHERE id = $1
+        `
+		return m.execOne(query, id, sendErr.Error())
+	}
+
+	query := `
+        UPDATE emails
+        SET next_attempt_at = $2, last_error = $3
+        WHERE id = $1
+    `
+
+	return m.execOne(query, id, retryAt, sendErr.Error())
+}
+
+// Retry 把dead状态的邮件重新放回发件箱并重置尝试次数，邮件不存在或者不是dead状态时返回ErrRecordNotFound
+func (m EmailModel) Retry(id int64) (*Email, error) {
+	query := `
+        UPDATE emails
+        SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+        WHERE id = $1 AND status = 'dead'
+        RETURNING id, created_at, recipient, locale, template, status, attempts, next_attempt_at, last_error
+    `
+
+	var email Email
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.db().QueryRowContext(ctx, query, id).Scan(
+		&email.ID,
+		&email.CreatedAt,
+		&email.Recipient,
+		&email.Locale,
+		&email.Template,
+		&email.Status,
+		&email.Attempts,
+		&email.NextAttemptAt,
+		&email.LastError,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &email, nil
+}
+
+// GetAll 按照状态列出发件箱中的邮件，status为空时返回所有状态的邮件
+func (m EmailModel) GetAll(status string, filters Filters) ([]*Email, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at, recipient, locale, template, status, attempts, next_attempt_at, last_error, sent_at
+        FROM emails
+        WHERE (status = $1 OR $1 = '')
+        ORDER BY %s %s, id ASC
+        LIMIT $2 OFFSET $3
+    `, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db().QueryContext(ctx, query, status, filters.limit(), filters.Offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	emails := []*Email{}
+
+	for rows.Next() {
+		var email Email
+
+		err := rows.Scan(
+			&totalRecords,
+			&email.ID,
+			&email.CreatedAt,
+			&email.Recipient,
+			&email.Locale,
+			&email.Template,
+			&email.Status,
+			&email.Attempts,
+			&email.NextAttemptAt,
+			&email.LastError,
+			&email.SentAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		emails = append(emails, &email)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return emails, metadata, nil
+}
+
+// Counts 返回每种状态的邮件数量，没有邮件的状态数量为0
+func (m EmailModel) Counts() (map[string]int, error) {
+	query := `
+        SELECT status, count(*)
+        FROM emails
+        GROUP BY status
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db().QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	counts := make(map[string]int, len(EmailStatusSafelist))
+	for _, status := range EmailStatusSafelist {
+		counts[status] = 0
+	}
+
+	for rows.Next() {
+		var (
+			status string
+			count  int
+		)
+
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+
+		counts[status] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func (m EmailModel) execOne(query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.db().ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestTx 连接GREENLIGHT_TEST_DB_DSN指定的已经执行过迁移的数据库，并开始一个测试结束时回滚的事务。
+// 没有设置该环境变量时跳过测试
+func newTestTx(t *testing.T) *sql.Tx {
+	t.Helper()
+
+	dsn := os.Getenv("GREENLIGHT_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("GREENLIGHT_TEST_DB_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+
+	return tx
+}
+
+func TestEmailRetry(t *testing.T) {
+	m := EmailModel{tx: newTestTx(t)}
+
+	email := &Email{
+		Recipient: "alice@example.com",
+		Locale:    "en",
+		Template:  "user_welcome.tmpl",
+		Data:      map[string]any{"activationToken": "ABCDEFGHIJKLMNOPQRSTUVWXYZ", "userID": 42},
+	}
+
+	if err := m.Insert(email); err != nil {
+		t.Fatal(err)
+	}
+
+	// 还没有进入dead状态的邮件不能重试
+	if _, err := m.Retry(email.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("retrying a pending email: got error %v; want %v", err, ErrRecordNotFound)
+	}
+
+	if err := m.MarkFailed(email.ID, errors.New("connection refused"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	retried, err := m.Retry(email.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if retried.Status != EmailPending || retried.Attempts != 0 || retried.LastError != "connection refused" {
+		t.Errorf("got status %q, attempts %d, last error %q; want %q, 0, %q",
+			retried.Status, retried.Attempts, retried.LastError, EmailPending, "connection refused")
+	}
+
+	// 模板数据保留下来，重新发送时与第一次发送的内容相同
+	var data []byte
+	if err := m.tx.QueryRow(`SELECT data FROM emails WHERE id = $1`, email.ID).Scan(&data); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got["activationToken"] != "ABCDEFGHIJKLMNOPQRSTUVWXYZ" || got["userID"] != float64(42) {
+		t.Errorf("got data %v after retry", got)
+	}
+
+	// 已经重新进入发件箱的邮件不能再次重试
+	if _, err := m.Retry(email.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("retrying a retried email: got error %v; want %v", err, ErrRecordNotFound)
+	}
+}
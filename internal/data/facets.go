@@ -0,0 +1,22 @@
+package data
+
+import "github.com/wangyaodream/greenlight/internal/validator"
+
+// MovieFacetSafelist 是电影列表支持的分面
+var MovieFacetSafelist = []string{"genres", "year", "decade"}
+
+type FacetCount struct {
+	Value any `json:"value"`
+	Count int `json:"count"`
+}
+
+// Facets 以分面名称为键，保存每个取值对应的记录数量
+type Facets map[string][]FacetCount
+
+func ValidateFacets(v *validator.Validator, facets []string) {
+	for _, facet := range facets {
+		v.Check(validator.PermiteedValue(facet, MovieFacetSafelist...), "facets", "invalid facet value")
+	}
+
+	v.Check(validator.Unique(facets), "facets", "must not contain duplicate values")
+}
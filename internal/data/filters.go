@@ -1,8 +1,17 @@
 package data
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
 
 	"github.com/wangyaodream/greenlight/internal/validator"
 )
@@ -12,14 +21,84 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	// Keyset 为true时使用游标分页，After为上一页返回的游标，第一页时为nil
+	Keyset bool
+	After  *Cursor
+	// Fields 为稀疏字段集，为空时查询所有字段
+	Fields []string
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+}
+
+// Cursor 记录上一页最后一条记录的排序字段、排序键和ID，编码后作为不透明的next_cursor返回给客户端
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value any    `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+func (c Cursor) Encode() string {
+	js, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	// 使用json.Number保留整数排序键的精度
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var c Cursor
+	if err := dec.Decode(&c); err != nil || c.Value == nil || c.ID < 1 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// validValue 检查游标中的排序键类型是否与排序字段一致，避免被篡改的游标在查询时导致数据库错误
+func (c Cursor) validValue(column string) bool {
+	switch column {
+	case "title":
+		_, ok := c.Value.(string)
+		return ok
+	case "relevance":
+		n, ok := c.Value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Float64()
+		return err == nil
+	case "id", "year", "runtime":
+		n, ok := c.Value.(json.Number)
+		if !ok {
+			return false
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return false
+		}
+		return column == "id" || (i >= math.MinInt32 && i <= math.MaxInt32)
+	default:
+		return false
+	}
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -37,13 +116,68 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
-	// 检查page和PageSize字段是否有效
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 10_000, "page", "must be a maximum of 10,000")
+	// 检查page和PageSize字段是否有效，游标分页时忽略page
+	if !f.Keyset {
+		v.Check(f.Page > 0, "page", "must be greater than zero")
+		v.Check(f.Page <= 10_000, "page", "must be a maximum of 10,000")
+	}
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
 	v.Check(validator.PermiteedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+
+	if f.After != nil {
+		v.Check(f.After.Sort == f.Sort, "cursor", "does not match the sort parameter")
+
+		if f.After.Sort == f.Sort && validator.PermiteedValue(f.Sort, f.SortSafelist...) {
+			v.Check(f.After.validValue(f.sortColumn()), "cursor", "must be a value returned in next_cursor")
+		}
+	}
+}
+
+// ValidateFields 检查稀疏字段集中的字段是否都在safelist中
+func ValidateFields(v *validator.Validator, fields []string, safelist []string) {
+	for _, field := range fields {
+		v.Check(validator.PermiteedValue(field, safelist...), "fields", fmt.Sprintf("unknown field %q", field))
+	}
+
+	v.Check(validator.Unique(fields), "fields", "must not contain duplicate values")
+}
+
+// ExcludeFields 返回safelist中除去exclude之后的字段，exclude中的未知字段会被记录为错误。
+// 排除所有字段也是错误，因为空的字段集表示查询所有字段
+func ExcludeFields(v *validator.Validator, exclude []string, safelist []string) []string {
+	for _, field := range exclude {
+		v.Check(validator.PermiteedValue(field, safelist...), "exclude", fmt.Sprintf("unknown field %q", field))
+	}
+
+	fields := []string{}
+	for _, field := range safelist {
+		if !validator.PermiteedValue(field, exclude...) {
+			fields = append(fields, field)
+		}
+	}
+
+	v.Check(len(fields) > 0, "exclude", "must not exclude every field")
+
+	return fields
+}
+
+// selectedFields 返回需要查询的列，required中的列即使没有被请求也会查询，
+// 例如游标分页需要的id和排序字段
+func (f Filters) selectedFields(required ...string) []string {
+	if len(f.Fields) == 0 {
+		return movieColumns
+	}
+
+	fields := []string{}
+	for _, field := range append(required, f.Fields...) {
+		if validator.PermiteedValue(field, movieColumns...) && !validator.PermiteedValue(field, fields...) {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
 }
 
 func (f Filters) sortColumn() string {
@@ -72,3 +206,121 @@ func (f Filters) limit() int {
 func (f Filters) Offset() int {
 	return (f.Page - 1) * f.PageSize
 }
+
+// seekClause 返回游标分页的查找条件，$10为排序键，$11为ID，相同排序键的记录按照id升序排列
+func (f Filters) seekClause(sortExpr, direction string) string {
+	op := ">"
+	if direction == "DESC" {
+		op = "<"
+	}
+
+	return fmt.Sprintf(" AND (%[1]s %[2]s $10 OR (%[1]s = $10 AND id > $11))", sortExpr, op)
+}
+
+// cursorAfter 返回指向movie之后的游标
+func (f Filters) cursorAfter(movie *Movie) Cursor {
+	c := Cursor{Sort: f.Sort, ID: movie.ID}
+
+	switch f.sortColumn() {
+	case "id":
+		c.Value = movie.ID
+	case "title":
+		c.Value = movie.Title
+	case "year":
+		c.Value = movie.Year
+	case "runtime":
+		c.Value = int32(movie.Runtime)
+	case "relevance":
+		c.Value = movie.rank
+	default:
+		panic("unsupported cursor sort parameter: " + f.Sort)
+	}
+
+	return c
+}
+
+// MovieFilter 保存电影列表的筛选条件，零值表示不使用对应的条件
+type MovieFilter struct {
+	Title         string
+	Prefix        bool     // 把标题中的每个词作为前缀匹配，用于输入时的即时搜索
+	Genres        []string // 必须包含所有类型
+	GenresAny     []string // 至少包含其中一个类型
+	ExcludeGenres []string // 不能包含其中任何一个类型
+	YearFrom      int
+	YearTo        int
+	RuntimeMin    int
+	RuntimeMax    int
+}
+
+func ValidateMovieFilter(v *validator.Validator, f MovieFilter) {
+	currentYear := time.Now().Year()
+
+	if f.YearFrom != 0 {
+		v.Check(f.YearFrom >= 1888 && f.YearFrom <= currentYear, "year_from", "must be between 1888 and the current year")
+	}
+	if f.YearTo != 0 {
+		v.Check(f.YearTo >= 1888 && f.YearTo <= currentYear, "year_to", "must be between 1888 and the current year")
+	}
+	if f.YearFrom != 0 && f.YearTo != 0 {
+		v.Check(f.YearFrom <= f.YearTo, "year_to", "must not be less than year_from")
+	}
+
+	v.Check(f.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(f.RuntimeMax >= 0, "runtime_max", "must not be negative")
+	if f.RuntimeMin != 0 && f.RuntimeMax != 0 {
+		v.Check(f.RuntimeMin <= f.RuntimeMax, "runtime_max", "must not be less than runtime_min")
+	}
+
+	v.Check(len(f.Genres) <= 5, "genres", "must not contain more than 5 genres")
+	v.Check(len(f.GenresAny) <= 20, "genres_any", "must not contain more than 20 genres")
+	v.Check(len(f.ExcludeGenres) <= 20, "exclude_genres", "must not contain more than 20 genres")
+}
+
+// args 返回movieFilterClause中占位符对应的参数
+func (f MovieFilter) args() []any {
+	return []any{
+		f.searchText(),
+		pq.Array(nonNil(f.Genres)),
+		pq.Array(nonNil(f.GenresAny)),
+		pq.Array(nonNil(f.ExcludeGenres)),
+		f.YearFrom,
+		f.YearTo,
+		f.RuntimeMin,
+		f.RuntimeMax,
+	}
+}
+
+// tsquery 返回把$1转换为tsquery的SQL表达式，config必须已经通过SearchConfigSafelist检查
+func (f MovieFilter) tsquery(config string) string {
+	if f.Prefix {
+		return fmt.Sprintf("to_tsquery('%s', $1)", config)
+	}
+
+	return fmt.Sprintf("plainto_tsquery('%s', $1)", config)
+}
+
+// searchText 返回$1的值，前缀匹配时把标题转换为 "term:* & term:*" 形式的tsquery文本，
+// 只保留字母和数字，避免用户输入的运算符导致to_tsquery语法错误
+func (f MovieFilter) searchText() string {
+	if !f.Prefix {
+		return f.Title
+	}
+
+	terms := strings.FieldsFunc(f.Title, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i := range terms {
+		terms[i] = terms[i] + ":*"
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+// nonNil 保证切片不为nil，pq会把nil切片编码为NULL而不是'{}'
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,131 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type Genre struct {
+	Slug       string `json:"slug"`
+	Name       string `json:"name"`
+	MovieCount int    `json:"movie_count"`
+}
+
+// GenreTaxonomy 保存小写别名到规范slug的映射，用于校验和规范化电影类型
+type GenreTaxonomy struct {
+	aliases map[string]string
+}
+
+func NewGenreTaxonomy(aliases map[string]string) *GenreTaxonomy {
+	t := &GenreTaxonomy{aliases: make(map[string]string, len(aliases))}
+
+	for alias, slug := range aliases {
+		t.aliases[strings.ToLower(strings.TrimSpace(alias))] = slug
+	}
+
+	return t
+}
+
+// Canonical 返回name对应的规范slug，匹配时忽略大小写和首尾空格
+func (t *GenreTaxonomy) Canonical(name string) (string, bool) {
+	slug, ok := t.aliases[strings.ToLower(strings.TrimSpace(name))]
+	return slug, ok
+}
+
+// CanonicalAll 规范化一组类型，无法识别的类型保持原样
+func (t *GenreTaxonomy) CanonicalAll(names []string) []string {
+	slugs := make([]string, len(names))
+
+	for i, name := range names {
+		if slug, ok := t.Canonical(name); ok {
+			slugs[i] = slug
+		} else {
+			slugs[i] = name
+		}
+	}
+
+	return slugs
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+// GetAll 返回所有类型以及每个类型下的电影数量
+func (m GenreModel) GetAll() ([]*Genre, error) {
+	query := `
+        SELECT genres.slug, genres.name, count(movies.id)
+        FROM genres
+        LEFT JOIN movies ON genres.slug = ANY(movies.genres) AND movies.deleted_at IS NULL
+        GROUP BY genres.slug, genres.name
+        ORDER BY genres.name ASC
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+
+		err := rows.Scan(&genre.Slug, &genre.Name, &genre.MovieCount)
+		if err != nil {
+			return nil, err
+		}
+
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+// Taxonomy 从数据库中加载所有别名
+func (m GenreModel) Taxonomy() (*GenreTaxonomy, error) {
+	query := `
+        SELECT alias, genre_slug
+        FROM genre_aliases
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	aliases := make(map[string]string)
+
+	for rows.Next() {
+		var alias, slug string
+
+		err := rows.Scan(&alias, &slug)
+		if err != nil {
+			return nil, err
+		}
+
+		aliases[alias] = slug
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewGenreTaxonomy(aliases), nil
+}
@@ -0,0 +1,400 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wangyaodream/greenlight/internal/validator"
+)
+
+var (
+	ErrDuplicateListMovie = errors.New("duplicate list movie")
+	ErrListMovieMismatch  = errors.New("list movie mismatch")
+)
+
+// List 是由用户维护的片单，Movies 按照 position 排序
+type List struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UserID      int64     `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Public      bool      `json:"public"`
+	Movies      []*Movie  `json:"movies,omitempty"`
+	Version     int32     `json:"version"`
+}
+
+// VisibleTo 判断片单是否对指定用户可见，公开片单对所有人(包括匿名用户)可见
+func (l *List) VisibleTo(user *User) bool {
+	if l.Public {
+		return true
+	}
+
+	return !user.IsAnonymous() && user.ID == l.UserID
+}
+
+type ListModel struct {
+	DB *sql.DB
+}
+
+func (m ListModel) Insert(list *List) error {
+	query := `
+        INSERT INTO lists (user_id, name, description, public)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at, version
+    `
+	args := []any{list.UserID, list.Name, list.Description, list.Public}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.CreatedAt, &list.Version)
+}
+
+func (m ListModel) Get(id int64) (*List, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, created_at, user_id, name, description, public, version
+        FROM lists
+        WHERE id = $1
+    `
+
+	var list List
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&list.ID,
+		&list.CreatedAt,
+		&list.UserID,
+		&list.Name,
+		&list.Description,
+		&list.Public,
+		&list.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &list, nil
+}
+
+// GetAll 返回公开的片单以及userID所拥有的私有片单，匿名用户的ID为0因此只能看到公开片单
+func (m ListModel) GetAll(name string, userID int64, filters Filters) ([]*List, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at, user_id, name, description, public, version
+        FROM lists
+        WHERE (public OR user_id = $1)
+        AND (to_tsvector('simple', name) @@ plainto_tsquery('simple', $2) OR $2 = '')
+        ORDER BY %s %s, id ASC
+        LIMIT $3 OFFSET $4
+    `, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{userID, name, filters.limit(), filters.Offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	lists := []*List{}
+
+	for rows.Next() {
+		var list List
+
+		err := rows.Scan(
+			&totalRecords,
+			&list.ID,
+			&list.CreatedAt,
+			&list.UserID,
+			&list.Name,
+			&list.Description,
+			&list.Public,
+			&list.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		lists = append(lists, &list)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return lists, metadata, nil
+}
+
+func (m ListModel) Update(list *List) error {
+	query := `
+        UPDATE lists
+        SET name = $1, description = $2, public = $3, version = version + 1
+        WHERE id = $4 AND version = $5
+        RETURNING version
+    `
+
+	args := []any{list.Name, list.Description, list.Public, list.ID, list.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&list.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ListModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        DELETE FROM lists
+        WHERE id = $1
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetMovies 按照片单中的顺序返回所有电影
+func (m ListModel) GetMovies(listID int64) ([]*Movie, error) {
+	query := `
+        SELECT movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.version
+        FROM movies
+        INNER JOIN lists_movies ON lists_movies.movie_id = movies.id
+        WHERE lists_movies.list_id = $1 AND movies.deleted_at IS NULL
+        ORDER BY lists_movies.position ASC, movies.id ASC
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+// AddMovie 将电影追加到片单的末尾，已经软删除的电影不能被添加
+func (m ListModel) AddMovie(listID, movieID int64) error {
+	query := `
+        INSERT INTO lists_movies (list_id, movie_id, position)
+        SELECT $1, $2, COALESCE(MAX(position), 0) + 1
+        FROM lists_movies
+        WHERE list_id = $1
+        HAVING EXISTS (SELECT 1 FROM movies WHERE id = $2 AND deleted_at IS NULL)
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, listID, movieID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "lists_movies_pkey"`:
+			return ErrDuplicateListMovie
+		case err.Error() == `pq: insert or update on table "lists_movies" violates foreign key constraint "lists_movies_movie_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m ListModel) RemoveMovie(listID, movieID int64) error {
+	query := `
+        DELETE FROM lists_movies
+        WHERE list_id = $1 AND movie_id = $2
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, listID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ReorderMovies 按照movieIDs的顺序重新排列片单，movieIDs必须恰好包含片单中所有未被软删除的电影，
+// 也就是GetMovies返回的电影。软删除的电影对客户端不可见，保持原来的相对顺序排在重新排列的电影之后，
+// 电影恢复之后出现在片单的末尾
+func (m ListModel) ReorderMovies(listID int64, movieIDs []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 锁定片单中现有的条目，避免并发的增删导致顺序错乱
+	rows, err := tx.QueryContext(ctx, `
+        SELECT lists_movies.movie_id, movies.deleted_at IS NULL
+        FROM lists_movies
+        INNER JOIN movies ON movies.id = lists_movies.movie_id
+        WHERE lists_movies.list_id = $1
+        ORDER BY lists_movies.position ASC, lists_movies.movie_id ASC
+        FOR UPDATE OF lists_movies
+    `, listID)
+	if err != nil {
+		return err
+	}
+
+	var (
+		visible = make(map[int64]bool)
+		hidden  []int64
+	)
+
+	for rows.Next() {
+		var (
+			movieID int64
+			active  bool
+		)
+		if err := rows.Scan(&movieID, &active); err != nil {
+			rows.Close()
+			return err
+		}
+
+		if active {
+			visible[movieID] = true
+		} else {
+			hidden = append(hidden, movieID)
+		}
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(visible) != len(movieIDs) {
+		return ErrListMovieMismatch
+	}
+
+	for _, movieID := range movieIDs {
+		if !visible[movieID] {
+			return ErrListMovieMismatch
+		}
+	}
+
+	for i, movieID := range append(slices.Clone(movieIDs), hidden...) {
+		_, err = tx.ExecContext(ctx, `
+            UPDATE lists_movies
+            SET position = $1
+            WHERE list_id = $2 AND movie_id = $3
+        `, i+1, listID, movieID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(list.Name != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	v.Check(len(list.Description) <= 2000, "description", "must not be more than 2000 bytes long")
+}
@@ -15,6 +15,10 @@ type Models struct {
 	Tokens      TokenModel
 	Users       UserModel
 	Permissions PermissionModel
+	Lists       ListModel
+	Genres      GenreModel
+	Revisions   MovieRevisionModel
+	Emails      EmailModel
 }
 
 func NewModels(db *sql.DB) Models {
@@ -23,5 +27,32 @@ func NewModels(db *sql.DB) Models {
 		Users:       UserModel{DB: db},
 		Tokens:      TokenModel{DB: db},
 		Permissions: PermissionModel{DB: db},
+		Lists:       ListModel{DB: db},
+		Genres:      GenreModel{DB: db},
+		Revisions:   MovieRevisionModel{DB: db},
+		Emails:      EmailModel{DB: db},
 	}
 }
+
+// InTx 在同一个事务中执行fn，fn返回错误时回滚事务，否则提交事务。
+// fn的参数中Movies、Users、Tokens、Permissions和Emails绑定到该事务，其他模型仍然直接使用连接池
+func (m Models) InTx(fn func(models Models) error) error {
+	tx, err := m.Users.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	m.Movies.tx = tx
+	m.Users.tx = tx
+	m.Tokens.tx = tx
+	m.Permissions.tx = tx
+	m.Emails.tx = tx
+
+	err = fn(m)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
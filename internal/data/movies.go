@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -19,44 +20,236 @@ type Movie struct {
 	Runtime   Runtime   `json:"runtime,omitempty"` // Runtime类型是自定义类型，实现了json.Unmarshaler接口
 	Genres    []string  `json:"genres,omitempty"`
 	Version   int32     `json:"version"`
+	Headline  string    `json:"headline,omitempty"` // 搜索时高亮匹配词的标题片段
+	rank      float64   // 搜索时的相关度，用于生成游标
 }
 
 type MovieModel struct {
 	DB *sql.DB
+	// SearchConfig 是全文搜索使用的文本搜索配置，例如simple或english，必须在SearchConfigSafelist中
+	SearchConfig string
+	// tx 不为nil时所有操作都在该事务中执行，参见InTx
+	tx *sql.Tx
 }
 
-func (m MovieModel) Insert(movie *Movie) error {
-	query := `
-        INSERT INTO movies (title, year, runtime, genres)
-        VALUES ($1, $2, $3, $4)
-        RETURNING id, created_at, version
-    `
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+// queryer 是*sql.DB和*sql.Tx共有的查询方法
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (m MovieModel) db() queryer {
+	if m.tx != nil {
+		return m.tx
+	}
+
+	return m.DB
+}
+
+// InTx 在同一个事务中执行fn，fn返回错误时回滚事务，否则提交事务。
+// fn的参数是绑定到该事务的MovieModel
+func (m MovieModel) InTx(fn func(movies MovieModel) error) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	m.tx = tx
+
+	err = fn(m)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SearchConfigSafelist 是允许使用的PostgreSQL文本搜索配置，会被直接拼接到SQL中
+var SearchConfigSafelist = []string{
+	"simple", "danish", "dutch", "english", "finnish", "french", "german", "hungarian",
+	"italian", "norwegian", "portuguese", "romanian", "russian", "spanish", "swedish", "turkish",
+}
+
+func (m MovieModel) searchConfig() string {
+	for _, safeValue := range SearchConfigSafelist {
+		if m.SearchConfig == safeValue {
+			return safeValue
+		}
+	}
+
+	if m.SearchConfig == "" {
+		return "simple"
+	}
+
+	panic("unsafe search config: " + m.SearchConfig)
+}
+
+// Insert 插入电影并记录editorID创建电影的修改记录
+func (m MovieModel) Insert(movie *Movie, editorID int64) error {
+	query := fmt.Sprintf(`
+        WITH inserted AS (
+            INSERT INTO movies (title, year, runtime, genres)
+            VALUES ($1, $2, $3, $4)
+            RETURNING id, created_at, title, year, runtime, genres, version
+        ), revision AS (
+            INSERT INTO movie_revisions (movie_id, version, user_id, action, previous, current)
+            SELECT id, version, $5, 'insert', NULL, %s
+            FROM inserted
+        )
+        SELECT id, created_at, version FROM inserted
+    `, movieSnapshot("inserted"))
+	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), editorID}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	return m.db().QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+}
+
+// ETag 根据ID和版本号生成实体标签，版本号在每次更新时递增
+func (movie *Movie) ETag() string {
+	return fmt.Sprintf(`"%d-%d"`, movie.ID, movie.Version)
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+// MovieFieldSafelist 是稀疏字段集允许使用的字段，与Movie的JSON字段名一致
+var MovieFieldSafelist = []string{"id", "title", "year", "runtime", "genres", "version", "headline"}
+
+// movieColumns 是不指定字段时查询的所有列，headline为计算列
+var movieColumns = []string{"id", "created_at", "title", "year", "runtime", "genres", "version", "headline"}
+
+// scanDest 返回与columns顺序一致的扫描目标
+func (movie *Movie) scanDest(columns []string) []any {
+	dest := make([]any, len(columns))
+
+	for i, column := range columns {
+		switch column {
+		case "id":
+			dest[i] = &movie.ID
+		case "created_at":
+			dest[i] = &movie.CreatedAt
+		case "title":
+			dest[i] = &movie.Title
+		case "year":
+			dest[i] = &movie.Year
+		case "runtime":
+			dest[i] = &movie.Runtime
+		case "genres":
+			dest[i] = pq.Array(&movie.Genres)
+		case "version":
+			dest[i] = &movie.Version
+		case "headline":
+			dest[i] = &movie.Headline
+		default:
+			panic("unknown movie column: " + column)
+		}
+	}
+
+	return dest
+}
+
+// Project 返回只包含fields中字段的map，用于稀疏字段集的JSON输出，fields为空时返回movie本身
+func (movie *Movie) Project(fields []string) any {
+	if len(fields) == 0 {
+		return movie
+	}
+
+	projected := make(map[string]any, len(fields))
+
+	for _, field := range fields {
+		switch field {
+		case "id":
+			projected[field] = movie.ID
+		case "title":
+			projected[field] = movie.Title
+		case "year":
+			projected[field] = movie.Year
+		case "runtime":
+			projected[field] = movie.Runtime
+		case "genres":
+			projected[field] = movie.Genres
+		case "version":
+			projected[field] = movie.Version
+		case "headline":
+			// 与完整输出一致，没有搜索时不返回headline
+			if movie.Headline != "" {
+				projected[field] = movie.Headline
+			}
+		}
+	}
+
+	return projected
+}
+
+// filterClause 返回GetAll和Facets共用的WHERE条件，参数顺序与MovieFilter.args()一致，
+// 取值为空或者0的条件不生效，已经软删除的电影总是被排除
+func (m MovieModel) filterClause(filter MovieFilter) string {
+	return fmt.Sprintf(`
+        deleted_at IS NULL
+        AND (to_tsvector('%s', title) @@ %s OR $1 = '')
+        AND (genres @> $2 OR $2 = '{}')
+        AND (genres && $3 OR $3 = '{}')
+        AND NOT (genres && $4)
+        AND (year >= $5 OR $5 = 0)
+        AND (year <= $6 OR $6 = 0)
+        AND (runtime >= $7 OR $7 = 0)
+        AND (runtime <= $8 OR $8 = 0)
+    `, m.searchConfig(), filter.tsquery(m.searchConfig()))
+}
+
+func (m MovieModel) GetAll(filter MovieFilter, filters Filters) ([]*Movie, Metadata, error) {
+	config := m.searchConfig()
+	tsquery := filter.tsquery(config)
+	rank := fmt.Sprintf("CASE WHEN $1 = '' THEN 0 ELSE ts_rank(to_tsvector('%s', title), %s) END", config, tsquery)
+
+	// relevance 按照匹配程度从高到低排序，其余字段直接使用列名
+	sortExpr, direction := filters.sortColumn(), filters.sortDirection()
+	if sortExpr == "relevance" {
+		sortExpr, direction = rank, "DESC"
+	}
+
+	where := m.filterClause(filter)
+	args := filter.args()
+
+	// 游标模式不计算总数也不使用OFFSET，而是从上一页最后一条记录的排序键之后继续查找，
+	// 多查询一条记录用于判断是否还有下一页
+	total, page := "count(*) OVER()", "LIMIT $9 OFFSET $10"
+	if filters.Keyset {
+		total, page = "0", "LIMIT $9"
+		args = append(args, filters.limit()+1)
+
+		if filters.After != nil {
+			where += filters.seekClause(sortExpr, direction)
+			args = append(args, filters.After.Value, filters.After.ID)
+		}
+	} else {
+		args = append(args, filters.limit(), filters.Offset())
+	}
+
+	// 只查询请求的字段，id和排序字段始终需要查询用于生成游标，version用于生成ETag
+	fields := filters.selectedFields("id", "version", filters.sortColumn())
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = field
+		if field == "headline" {
+			columns[i] = fmt.Sprintf("CASE WHEN $1 = '' THEN '' ELSE ts_headline('%s', title, %s) END", config, tsquery)
+		}
+	}
+
 	query := fmt.Sprintf(`
-        SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+        SELECT %s, %s, %s
         FROM movies
-        WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-        AND (genres @> $2 OR $2 = '{}')
+        WHERE %s
         ORDER BY %s %s, id ASC
-        LIMIT $3 OFFSET $4
-    `, filters.sortColumn(), filters.sortDirection())
-
+        %s
+    `, total, strings.Join(columns, ", "), rank, where, sortExpr, direction, page)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{title, pq.Array(genres), filters.limit(), filters.Offset()}
-
 	// title 和 genres 作为占位符传递给查询
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	rows, err := m.db().QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -69,16 +262,10 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	for rows.Next() {
 		var movie Movie
 
-		err := rows.Scan(
-			&totalRecords,
-			&movie.ID,
-			&movie.CreatedAt,
-			&movie.Title,
-			&movie.Year,
-			&movie.Runtime,
-			pq.Array(&movie.Genres),
-			&movie.Version,
-		)
+		dest := append([]any{&totalRecords}, movie.scanDest(fields)...)
+		dest = append(dest, &movie.rank)
+
+		err := rows.Scan(dest...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -90,12 +277,230 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 		return nil, Metadata{}, err
 	}
 
+	if filters.Keyset {
+		metadata := Metadata{PageSize: filters.PageSize}
+
+		if len(movies) > filters.limit() {
+			movies = movies[:filters.limit()]
+			metadata.NextCursor = filters.cursorAfter(movies[len(movies)-1]).Encode()
+		}
+
+		return movies, metadata, nil
+	}
+
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 
 	return movies, metadata, nil
 }
 
+// Export 按照与GetAll相同的筛选条件和排序遍历所有匹配的电影，每部电影调用一次fn。
+// 所有电影来自同一个只读的REPEATABLE READ事务中的一次查询，结果逐行读取，
+// 导出期间的修改不会导致电影重复或者遗漏，内存占用也与结果总数无关。
+// 查询使用调用者的ctx，ctx取消或者fn返回错误时停止导出
+func (m MovieModel) Export(ctx context.Context, filter MovieFilter, filters Filters, fn func(*Movie) error) error {
+	config := m.searchConfig()
+	tsquery := filter.tsquery(config)
+
+	sortExpr, direction := filters.sortColumn(), filters.sortDirection()
+	if sortExpr == "relevance" {
+		sortExpr, direction = fmt.Sprintf("CASE WHEN $1 = '' THEN 0 ELSE ts_rank(to_tsvector('%s', title), %s) END", config, tsquery), "DESC"
+	}
+
+	columns := make([]string, len(movieColumns))
+	for i, field := range movieColumns {
+		columns[i] = field
+		if field == "headline" {
+			columns[i] = fmt.Sprintf("CASE WHEN $1 = '' THEN '' ELSE ts_headline('%s', title, %s) END", config, tsquery)
+		}
+	}
+
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM movies
+        WHERE %s
+        ORDER BY %s %s, id ASC
+    `, strings.Join(columns, ", "), m.filterClause(filter), sortExpr, direction)
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, filter.args()...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(movie.scanDest(movieColumns)...)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(&movie); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Facets 在与GetAll相同的筛选条件下统计每个分面的数量
+func (m MovieModel) Facets(filter MovieFilter, facets []string) (Facets, error) {
+	result := make(Facets, len(facets))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := filter.args()
+
+	for _, facet := range facets {
+		var query string
+
+		switch facet {
+		case "genres":
+			query = fmt.Sprintf(`
+                SELECT genre, count(*)
+                FROM movies, unnest(genres) AS genre
+                WHERE %s
+                GROUP BY genre
+                ORDER BY count(*) DESC, genre ASC
+            `, m.filterClause(filter))
+		case "year":
+			query = fmt.Sprintf(`
+                SELECT year, count(*)
+                FROM movies
+                WHERE %s
+                GROUP BY year
+                ORDER BY year ASC
+            `, m.filterClause(filter))
+		case "decade":
+			query = fmt.Sprintf(`
+                SELECT year / 10 * 10 AS decade, count(*)
+                FROM movies
+                WHERE %s
+                GROUP BY decade
+                ORDER BY decade ASC
+            `, m.filterClause(filter))
+		default:
+			panic("unsafe facet parameter: " + facet)
+		}
+
+		counts, err := m.facetCounts(ctx, facet, query, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		result[facet] = counts
+	}
+
+	return result, nil
+}
+
+func (m MovieModel) facetCounts(ctx context.Context, facet, query string, args ...any) ([]FacetCount, error) {
+	rows, err := m.db().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	counts := []FacetCount{}
+
+	for rows.Next() {
+		var count FacetCount
+
+		// genres 分面的值为字符串，year 和 decade 分面的值为整数
+		if facet == "genres" {
+			var genre string
+			err = rows.Scan(&genre, &count.Count)
+			count.Value = genre
+		} else {
+			var year int
+			err = rows.Scan(&year, &count.Count)
+			count.Value = year
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// MovieSuggestion 是标题联想返回的精简电影信息
+type MovieSuggestion struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Year  int32  `json:"year"`
+}
+
+// Suggest 使用pg_trgm的word_similarity模糊匹配标题，返回最相似的limit部电影
+func (m MovieModel) Suggest(q string, limit int) ([]*MovieSuggestion, error) {
+	query := `
+        SELECT id, title, year
+        FROM movies
+        WHERE $1 <% title AND deleted_at IS NULL
+        ORDER BY word_similarity($1, title) DESC, title ASC
+        LIMIT $2
+    `
+
+	// 联想接口在每次按键时调用，超时时间比其他查询更短
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := m.db().QueryContext(ctx, query, q, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	suggestions := []*MovieSuggestion{}
+
+	for rows.Next() {
+		var suggestion MovieSuggestion
+
+		err := rows.Scan(&suggestion.ID, &suggestion.Title, &suggestion.Year)
+		if err != nil {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
 func (m MovieModel) Get(id int64) (*Movie, error) {
+	return m.get(id, false)
+}
+
+// GetIncludingDeleted 和Get相同，但是同样返回已经被软删除的电影，用于永久删除之前的版本比较
+func (m MovieModel) GetIncludingDeleted(id int64) (*Movie, error) {
+	return m.get(id, true)
+}
+
+func (m MovieModel) get(id int64, includeDeleted bool) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
@@ -103,7 +508,7 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	query := `
         SELECT id, created_at, title, year, runtime, genres, version
         FROM movies
-        WHERE id = $1
+        WHERE id = $1 AND ($2 OR deleted_at IS NULL)
     `
 	var movie Movie
 
@@ -111,7 +516,7 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+	err := m.db().QueryRowContext(ctx, query, id, includeDeleted).Scan(
 		&movie.ID,
 		&movie.CreatedAt,
 		&movie.Title,
@@ -133,20 +538,141 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-func (m MovieModel) Update(movie *Movie) error {
-	query := `
-        UPDATE movies
-        SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+// Upsert 使用一条多行语句导入一批电影，按照title和year匹配已有的电影：
+// 已有电影的runtime或genres发生变化时更新，不存在时插入，没有变化的电影保持不变。
+// 插入或更新的电影会写回ID、CreatedAt和Version，没有变化的电影ID保持为0。
+// 导入没有编辑者，修改记录中的user_id为NULL。movies中不能包含title和year相同的电影
+func (m MovieModel) Upsert(movies []*Movie) (inserted, updated int, err error) {
+	if len(movies) == 0 {
+		return 0, 0, nil
+	}
+
+	values := make([]string, len(movies))
+	args := make([]any, 0, len(movies)*4)
+
+	for i, movie := range movies {
+		n := i * 4
+		values[i] = fmt.Sprintf("($%d, $%d::integer, $%d::integer, $%d::text[])", n+1, n+2, n+3, n+4)
+		args = append(args, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres))
+	}
+
+	query := fmt.Sprintf(`
+        WITH input (title, year, runtime, genres) AS (
+            VALUES %s
+        ), previous AS (
+            SELECT movies.id, movies.title, movies.year, movies.runtime, movies.genres
+            FROM movies
+            INNER JOIN input ON movies.title = input.title AND movies.year = input.year
+            WHERE movies.deleted_at IS NULL
+        ), updated AS (
+            UPDATE movies
+            SET runtime = input.runtime, genres = input.genres, version = movies.version + 1
+            FROM input
+            WHERE movies.title = input.title AND movies.year = input.year AND movies.deleted_at IS NULL
+            AND (movies.runtime <> input.runtime OR movies.genres <> input.genres)
+            RETURNING movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.version
+        ), inserted AS (
+            INSERT INTO movies (title, year, runtime, genres)
+            SELECT input.title, input.year, input.runtime, input.genres
+            FROM input
+            WHERE NOT EXISTS (
+                SELECT 1 FROM previous WHERE previous.title = input.title AND previous.year = input.year
+            )
+            RETURNING id, created_at, title, year, runtime, genres, version
+        ), revisions AS (
+            INSERT INTO movie_revisions (movie_id, version, user_id, action, previous, current)
+            SELECT updated.id, updated.version, NULL::bigint, 'update', %s, %s
+            FROM updated
+            INNER JOIN previous ON previous.id = updated.id
+            UNION ALL
+            SELECT inserted.id, inserted.version, NULL::bigint, 'insert', NULL::jsonb, %s
+            FROM inserted
+        )
+        SELECT id, created_at, title, year, version, true FROM inserted
+        UNION ALL
+        SELECT id, created_at, title, year, version, false FROM updated
+    `, strings.Join(values, ",\n"), movieSnapshot("previous"), movieSnapshot("updated"), movieSnapshot("inserted"))
+
+	// 一批数据可能较大，超时时间比单条记录的操作更长
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.db().QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer rows.Close()
+
+	type key struct {
+		title string
+		year  int32
+	}
+
+	byKey := make(map[key]*Movie, len(movies))
+	for _, movie := range movies {
+		byKey[key{movie.Title, movie.Year}] = movie
+	}
+
+	for rows.Next() {
+		var (
+			result     Movie
+			isInserted bool
+		)
+
+		err := rows.Scan(&result.ID, &result.CreatedAt, &result.Title, &result.Year, &result.Version, &isInserted)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		// 同一个title和year可能匹配多部已有的电影，只统计一次
+		movie := byKey[key{result.Title, result.Year}]
+		if movie == nil || movie.ID != 0 {
+			continue
+		}
+
+		movie.ID, movie.CreatedAt, movie.Version = result.ID, result.CreatedAt, result.Version
+
+		if isInserted {
+			inserted++
+		} else {
+			updated++
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	return inserted, updated, nil
+}
+
+// Update 使用version进行乐观锁更新，并在同一条语句中记录修改前后的值
+func (m MovieModel) Update(movie *Movie, editorID int64) error {
+	query := fmt.Sprintf(`
+        WITH previous AS (
+            SELECT id, title, year, runtime, genres
+            FROM movies
+            WHERE id = $5 AND version = $6 AND deleted_at IS NULL
+        ), updated AS (
+            UPDATE movies
+            SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
+            WHERE id = $5 AND version = $6 AND deleted_at IS NULL
+            RETURNING id, title, year, runtime, genres, version
+        )
+        INSERT INTO movie_revisions (movie_id, version, user_id, action, previous, current)
+        SELECT updated.id, updated.version, $7, 'update', %s, %s
+        FROM updated
+        INNER JOIN previous ON previous.id = updated.id
         RETURNING version
-    `
+    `, movieSnapshot("previous"), movieSnapshot("updated"))
 
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version}
+	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version, editorID}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	err := m.db().QueryRowContext(ctx, query, args...).Scan(&movie.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -157,23 +683,110 @@ func (m MovieModel) Update(movie *Movie) error {
 	}
 
 	return nil
+}
 
+// Delete 软删除电影，记录会被保留直到Purge或者后台任务在保留期之后清理。
+// version不为0时只有当前版本与version一致才会删除，否则返回ErrEditConflict，比较和删除在同一条语句中完成
+func (m MovieModel) Delete(id int64, version int32, editorID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := fmt.Sprintf(`
+        WITH deleted AS (
+            UPDATE movies
+            SET deleted_at = NOW(), version = version + 1
+            WHERE id = $1 AND deleted_at IS NULL AND ($3 = 0 OR version = $3)
+            RETURNING id, title, year, runtime, genres, version
+        )
+        INSERT INTO movie_revisions (movie_id, version, user_id, action, previous, current)
+        SELECT id, version, $2, 'delete', %s, NULL
+        FROM deleted
+    `, movieSnapshot("deleted"))
+
+	err := m.execOne(query, id, editorID, version)
+	if version != 0 && errors.Is(err, ErrRecordNotFound) {
+		return m.versionMismatch(id, false)
+	}
+
+	return err
 }
 
-func (m MovieModel) Delete(id int64) error {
+// Restore 恢复软删除的电影
+func (m MovieModel) Restore(id int64, editorID int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
+	query := fmt.Sprintf(`
+        WITH restored AS (
+            UPDATE movies
+            SET deleted_at = NULL, version = version + 1
+            WHERE id = $1 AND deleted_at IS NOT NULL
+            RETURNING id, title, year, runtime, genres, version
+        )
+        INSERT INTO movie_revisions (movie_id, version, user_id, action, previous, current)
+        SELECT id, version, $2, 'restore', NULL, %s
+        FROM restored
+    `, movieSnapshot("restored"))
+
+	return m.execOne(query, id, editorID)
+}
+
+// Purge 永久删除电影，无论是否已经被软删除，version的含义与Delete相同
+func (m MovieModel) Purge(id int64, version int32) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        DELETE FROM movies
+        WHERE id = $1 AND ($2 = 0 OR version = $2)
+    `
+
+	err := m.execOne(query, id, version)
+	if version != 0 && errors.Is(err, ErrRecordNotFound) {
+		return m.versionMismatch(id, true)
+	}
+
+	return err
+}
+
+// versionMismatch 在带有版本的语句没有影响任何行之后区分原因：电影存在时是版本不一致，返回ErrEditConflict，
+// 否则返回ErrRecordNotFound。includeDeleted表示软删除的电影是否算作存在
+func (m MovieModel) versionMismatch(id int64, includeDeleted bool) error {
+	_, err := m.get(id, includeDeleted)
+	if err != nil {
+		return err
+	}
+
+	return ErrEditConflict
+}
+
+// PurgeDeleted 永久删除软删除时间早于retention之前的电影，返回删除的数量
+func (m MovieModel) PurgeDeleted(retention time.Duration) (int64, error) {
 	query := `
         DELETE FROM movies
-        WHERE id = $1
+        WHERE deleted_at < $1
     `
 
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.db().ExecContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// execOne 执行只影响一条记录的语句，没有记录受到影响时返回ErrRecordNotFound
+func (m MovieModel) execOne(query string, args ...any) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.db().ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -190,7 +803,8 @@ func (m MovieModel) Delete(id int64) error {
 	return nil
 }
 
-func ValidateMovie(v *validator.Validator, movie *Movie) {
+// ValidateMovie 校验电影字段，同时使用genres把电影类型规范化为genres表中的slug
+func ValidateMovie(v *validator.Validator, movie *Movie, genres *GenreTaxonomy) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(len(movie.Title) < 500, "title", "must not be more than 500 bytes long")
 
@@ -205,5 +819,14 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genre")
 	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
 
+	for i, genre := range movie.Genres {
+		slug, ok := genres.Canonical(genre)
+		if !ok {
+			v.AddError("genres", fmt.Sprintf("contains unknown genre %q", genre))
+			continue
+		}
+		movie.Genres[i] = slug
+	}
+
 	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate genres")
 }
@@ -21,6 +21,17 @@ func (p Permissions) Include(code string) bool {
 
 type PermissionModel struct {
 	DB *sql.DB
+
+	// tx 不为nil时所有操作都在该事务中执行，参见Models.InTx
+	tx *sql.Tx
+}
+
+func (m PermissionModel) db() queryer {
+	if m.tx != nil {
+		return m.tx
+	}
+
+	return m.DB
 }
 
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
@@ -35,7 +46,7 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, userID)
+	rows, err := m.db().QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -68,6 +79,6 @@ func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
     ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
     defer cancel()
 
-    _, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+    _, err := m.db().ExecContext(ctx, query, userID, pq.Array(codes))
     return err
 }
@@ -0,0 +1,178 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// MovieSnapshot 是修改记录中保存的电影字段
+type MovieSnapshot struct {
+	Title   string   `json:"title"`
+	Year    int32    `json:"year"`
+	Runtime Runtime  `json:"runtime"`
+	Genres  []string `json:"genres"`
+}
+
+// Apply 把快照中的字段写回movie，不修改ID和Version
+func (s *MovieSnapshot) Apply(movie *Movie) {
+	movie.Title = s.Title
+	movie.Year = s.Year
+	movie.Runtime = s.Runtime
+	movie.Genres = slices.Clone(s.Genres)
+}
+
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// MovieRevision 是电影的一条修改记录，Version为修改之后电影的版本号。
+// Action是insert、update、delete或restore之一，恢复到历史版本记录为update
+type MovieRevision struct {
+	MovieID   int64                  `json:"movie_id"`
+	Version   int32                  `json:"version"`
+	UserID    int64                  `json:"user_id,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	Action    string                 `json:"action"`
+	Previous  *MovieSnapshot         `json:"previous"`
+	Current   *MovieSnapshot         `json:"current"`
+	Changes   map[string]FieldChange `json:"changes,omitempty"`
+}
+
+// diff 计算修改前后发生变化的字段
+func (r *MovieRevision) diff() {
+	if r.Previous == nil || r.Current == nil {
+		return
+	}
+
+	r.Changes = make(map[string]FieldChange)
+
+	if r.Previous.Title != r.Current.Title {
+		r.Changes["title"] = FieldChange{From: r.Previous.Title, To: r.Current.Title}
+	}
+	if r.Previous.Year != r.Current.Year {
+		r.Changes["year"] = FieldChange{From: r.Previous.Year, To: r.Current.Year}
+	}
+	if r.Previous.Runtime != r.Current.Runtime {
+		r.Changes["runtime"] = FieldChange{From: r.Previous.Runtime, To: r.Current.Runtime}
+	}
+	if !slices.Equal(r.Previous.Genres, r.Current.Genres) {
+		r.Changes["genres"] = FieldChange{From: r.Previous.Genres, To: r.Current.Genres}
+	}
+}
+
+// movieSnapshot 返回生成MovieSnapshot的SQL表达式，table为包含电影列的表名或者CTE名
+func movieSnapshot(table string) string {
+	return fmt.Sprintf(
+		`jsonb_build_object('title', %[1]s.title, 'year', %[1]s.year, 'runtime', %[1]s.runtime || ' mins', 'genres', %[1]s.genres)`,
+		table,
+	)
+}
+
+type MovieRevisionModel struct {
+	DB *sql.DB
+}
+
+// GetAllForMovie 按照版本号从新到旧返回电影的所有修改记录
+func (m MovieRevisionModel) GetAllForMovie(movieID int64) ([]*MovieRevision, error) {
+	query := `
+        SELECT movie_id, version, COALESCE(user_id, 0), created_at, action, previous, current
+        FROM movie_revisions
+        WHERE movie_id = $1
+        ORDER BY version DESC
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	revisions := []*MovieRevision{}
+
+	for rows.Next() {
+		revision, err := scanMovieRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (m MovieRevisionModel) Get(movieID int64, version int32) (*MovieRevision, error) {
+	query := `
+        SELECT movie_id, version, COALESCE(user_id, 0), created_at, action, previous, current
+        FROM movie_revisions
+        WHERE movie_id = $1 AND version = $2
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	revision, err := scanMovieRevision(m.DB.QueryRowContext(ctx, query, movieID, version))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return revision, nil
+}
+
+// scanMovieRevision 同时用于sql.Row和sql.Rows
+func scanMovieRevision(row interface{ Scan(...any) error }) (*MovieRevision, error) {
+	var (
+		revision          MovieRevision
+		previous, current []byte
+	)
+
+	err := row.Scan(
+		&revision.MovieID,
+		&revision.Version,
+		&revision.UserID,
+		&revision.CreatedAt,
+		&revision.Action,
+		&previous,
+		&current,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if previous != nil {
+		revision.Previous = &MovieSnapshot{}
+		if err := json.Unmarshal(previous, revision.Previous); err != nil {
+			return nil, err
+		}
+	}
+
+	if current != nil {
+		revision.Current = &MovieSnapshot{}
+		if err := json.Unmarshal(current, revision.Current); err != nil {
+			return nil, err
+		}
+	}
+
+	revision.diff()
+
+	return &revision, nil
+}
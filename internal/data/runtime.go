@@ -41,3 +41,19 @@ func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 
 	return nil
 }
+
+// ParseRuntime 解析导入数据中的时长，接受"数字 mins"格式或者单独的数字
+func ParseRuntime(s string) (Runtime, error) {
+	s = strings.TrimSpace(s)
+
+	if number, ok := strings.CutSuffix(s, " mins"); ok {
+		s = number
+	}
+
+	i, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0, ErrInvalidRuntimeFormat
+	}
+
+	return Runtime(i), nil
+}
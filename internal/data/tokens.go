@@ -59,6 +59,17 @@ func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 
 type TokenModel struct {
 	DB *sql.DB
+
+	// tx 不为nil时所有操作都在该事务中执行，参见Models.InTx
+	tx *sql.Tx
+}
+
+func (m TokenModel) db() queryer {
+	if m.tx != nil {
+		return m.tx
+	}
+
+	return m.DB
 }
 
 func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -79,7 +90,10 @@ func (m TokenModel) Insert(token *Token) error {
 
 	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
 
-	_, err := m.DB.Exec(query, args...)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.db().ExecContext(ctx, query, args...)
 	return err
 }
 
@@ -92,6 +106,6 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, scope, userID)
+	_, err := m.db().ExecContext(ctx, query, scope, userID)
 	return err
 }
@@ -15,6 +15,12 @@ var (
 	ErrDuplicateEmail = errors.New("duplicate email")
 )
 
+// DefaultLocale 是没有指定语言偏好时使用的语言
+const DefaultLocale = "en"
+
+// LocaleSafelist 是用户可以选择的语言，与邮件模板的语言目录一致
+var LocaleSafelist = []string{"en", "zh"}
+
 // 在使用`json:"-"`标签时，表示在序列化和反序列化时忽略该字段
 type User struct {
 	ID        int64     `json:"id"`
@@ -23,6 +29,7 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
+	Locale    string    `json:"locale"`
 	Version   int       `json:"-"`
 }
 
@@ -33,6 +40,17 @@ type password struct {
 
 type UserModel struct {
 	DB *sql.DB
+
+	// tx 不为nil时所有操作都在该事务中执行，参见Models.InTx
+	tx *sql.Tx
+}
+
+func (m UserModel) db() queryer {
+	if m.tx != nil {
+		return m.tx
+	}
+
+	return m.DB
 }
 
 var AnonymousUser = &User{}
@@ -43,16 +61,16 @@ func (u *User) IsAnonymous() bool {
 
 func (m UserModel) Insert(user *User) error {
 	query := `
-        INSERT INTO users (name, email, password_hash, activated)
-        VALUES ($1, $2, $3, $4)
+        INSERT INTO users (name, email, password_hash, activated, locale)
+        VALUES ($1, $2, $3, $4, $5)
         RETURNING id, created_at, version
     `
-	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.Locale}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err := m.db().QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -67,7 +85,7 @@ func (m UserModel) Insert(user *User) error {
 
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-        SELECT id, created_at, name, email, password_hash, activated, version
+        SELECT id, created_at, name, email, password_hash, activated, locale, version
         FROM users
         WHERE email = $1
     `
@@ -77,13 +95,14 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+	err := m.db().QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.CreatedAt,
 		&user.Name,
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Locale,
 		&user.Version,
 	)
 
@@ -101,17 +120,17 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 func (m UserModel) Update(user *User) error {
 	query := `
         UPDATE users
-        SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        SET name = $1, email = $2, password_hash = $3, activated = $4, locale = $5, version = version + 1
+        WHERE id = $6 AND version = $7
         RETURNING version
     `
 
-	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.ID, user.Version}
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.Locale, user.ID, user.Version}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	err := m.db().QueryRowContext(ctx, query, args...).Scan(&user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -131,7 +150,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
     tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
     query := `
-        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.locale, users.version
         FROM users
         INNER JOIN tokens
         ON users.id = tokens.user_id
@@ -146,13 +165,14 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
     defer cancel()
 
     // 执行查询
-    err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+    err := m.db().QueryRowContext(ctx, query, args...).Scan(
         &user.ID,
         &user.CreatedAt,
         &user.Name,
         &user.Email,
         &user.Password.hash,
         &user.Activated,
+        &user.Locale,
         &user.Version,
     )
     if err != nil {
@@ -212,6 +232,8 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 	ValidateEmail(v, user.Email)
 
+	v.Check(validator.PermiteedValue(user.Locale, LocaleSafelist...), "locale", "must be one of en or zh")
+
 	if user.Password.plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.plaintext)
 	}
@@ -2,17 +2,24 @@ package jsonlog
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"maps"
 	"os"
 	"runtime/debug"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Level int8
 
 const (
-	LevelInfo Level = iota
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
 	LevelError
 	LevelFatal
 	LevelOff
@@ -20,59 +27,178 @@ const (
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
 		return "FATAL"
+	case LevelOff:
+		return "OFF"
 	default:
 		return ""
 	}
 }
 
+// ParseLevel 解析不区分大小写的日志级别名称，例如"debug"或"WARN"
+func ParseLevel(s string) (Level, error) {
+	for l := LevelDebug; l <= LevelOff; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("invalid log level %q", s)
+}
+
+// ParseLevels 解析逗号分隔的日志级别列表，例如"warn,error,fatal"
+func ParseLevels(s string) ([]Level, error) {
+	var levels []Level
+
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		level, err := ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, level)
+	}
+
+	return levels, nil
+}
+
+// Sink 是日志的一个输出目标，只接收Levels中列出的级别，Levels为空时接收所有级别
+type Sink struct {
+	Writer io.Writer
+	Levels []Level
+}
+
+func (s Sink) accepts(level Level) bool {
+	return len(s.Levels) == 0 || slices.Contains(s.Levels, level)
+}
+
 type Logger struct {
-	out      io.Writer
-	minLevel Level
-	mu       sync.Mutex
+	sinks       []Sink
+	minLevel    atomic.Int32
+	stackTraces bool
+	sampler     *sampler
+	mu          sync.Mutex
 }
 
 func New(out io.Writer, minLevel Level) *Logger {
-	return &Logger{out: out, minLevel: minLevel}
+	return NewWithSinks(minLevel, Sink{Writer: out})
+}
+
+// NewWithSinks 返回把日志写入多个输出目标的Logger，每一行日志会写入所有接收该级别的目标
+func NewWithSinks(minLevel Level, sinks ...Sink) *Logger {
+	l := &Logger{sinks: sinks}
+	l.minLevel.Store(int32(minLevel))
+	return l
+}
+
+// SetLevel 修改输出的最低级别，可以在其他goroutine写日志的同时调用
+func (l *Logger) SetLevel(minLevel Level) {
+	l.minLevel.Store(int32(minLevel))
+}
+
+// Level 返回当前输出的最低级别
+func (l *Logger) Level() Level {
+	return Level(l.minLevel.Load())
+}
+
+// SetStackTraces 设置是否在ERROR及以上级别的日志中附加调用栈，默认不附加
+func (l *Logger) SetStackTraces(enabled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stackTraces = enabled
+}
+
+// SetSampling 对INFO及以下级别的日志按照消息内容采样：每个interval内同一条消息只输出前first次，
+// 之后每thereafter次输出一次，避免大量重复的日志占满磁盘。first为0时关闭采样
+func (l *Logger) SetSampling(interval time.Duration, first, thereafter int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if first <= 0 || interval <= 0 {
+		l.sampler = nil
+		return
+	}
+
+	l.sampler = newSampler(interval, first, thereafter)
 }
 
-func (l *Logger) PrintInfo(message string, properties map[string]string) {
+// Enabled 判断level级别的日志是否会被输出
+func (l *Logger) Enabled(level Level) bool {
+	minLevel := l.Level()
+	return level >= minLevel && minLevel != LevelOff
+}
+
+func (l *Logger) PrintDebug(message string, properties map[string]any) {
+	l.print(LevelDebug, message, properties)
+}
+
+func (l *Logger) PrintInfo(message string, properties map[string]any) {
 	l.print(LevelInfo, message, properties)
 }
 
-func (l *Logger) PrintError(err error, properties map[string]string) {
+func (l *Logger) PrintWarn(message string, properties map[string]any) {
+	l.print(LevelWarn, message, properties)
+}
+
+func (l *Logger) PrintError(err error, properties map[string]any) {
 	l.print(LevelError, err.Error(), properties)
 }
 
-func (l *Logger) PrintFatal(err error, properties map[string]string) {
+func (l *Logger) PrintFatal(err error, properties map[string]any) {
 	l.print(LevelFatal, err.Error(), properties)
 	os.Exit(1) // FATAL LEVEL 退出程序
 }
 
-func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
-	if level < l.minLevel {
+// print 输出一行JSON日志，properties中的值按照原本的类型编码，例如数字和布尔值不会被转换为字符串
+func (l *Logger) print(level Level, message string, properties map[string]any) (int, error) {
+	return l.printAt(level, time.Now(), message, properties)
+}
+
+// printAt 和print相同，但是使用t作为日志的时间，t为零值时不输出time字段
+func (l *Logger) printAt(level Level, t time.Time, message string, properties map[string]any) (int, error) {
+	if !l.Enabled(level) {
 		return 0, nil
 	}
 
 	aux := struct {
-		Level      string            `json:"level"`
-		Time       string            `json:"time"`
-		Message    string            `json:"message"`
-		Properties map[string]string `json:"properties,omitempty"`
-		Trace      string            `json:"trace,omitempty"`
+		Level      string         `json:"level"`
+		Time       string         `json:"time,omitempty"`
+		Message    string         `json:"message"`
+		Properties map[string]any `json:"properties,omitempty"`
+		Trace      string         `json:"trace,omitempty"`
 	}{
 		Level:      level.String(),
-		Time:       time.Now().UTC().Format(time.RFC3339),
 		Message:    message,
-		Properties: properties,
+		Properties: encodable(properties),
 	}
 
-	if level >= LevelError {
+	if !t.IsZero() {
+		aux.Time = t.UTC().Format(time.RFC3339)
+	}
+
+	// 为了避免在多个goroutine中同时写入，我们使用互斥锁
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if level <= LevelInfo && l.sampler != nil && !l.sampler.allow(level, message) {
+		return 0, nil
+	}
+
+	if level >= LevelError && l.stackTraces {
 		aux.Trace = string(debug.Stack())
 	}
 
@@ -83,11 +209,47 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 		line = []byte(LevelError.String() + ": unable to marshal log message: " + err.Error())
 	}
 
-	// 为了避免在多个goroutine中同时写入，我们使用互斥锁
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	line = append(line, '\n')
+
+	// 某个目标写入失败时仍然写入其他目标，返回第一个错误
+	var (
+		n        int
+		firstErr error
+	)
+
+	for _, sink := range l.sinks {
+		if !sink.accepts(level) {
+			continue
+		}
+
+		written, err := sink.Writer.Write(line)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		n = max(n, written)
+	}
+
+	return n, firstErr
+}
+
+// encodable 把properties中的error转换为错误信息，error通常没有导出的字段，直接编码只会得到{}
+func encodable(properties map[string]any) map[string]any {
+	var copied map[string]any
+
+	for key, value := range properties {
+		if err, ok := value.(error); ok {
+			if copied == nil {
+				copied = maps.Clone(properties)
+			}
+			copied[key] = err.Error()
+		}
+	}
+
+	if copied != nil {
+		return copied
+	}
 
-	return l.out.Write(append(line, '\n'))
+	return properties
 }
 
 // 相较于PrintError没有Properties参数，这个方法只接受一个message参数，这个方法是为了实现io.Writer接口
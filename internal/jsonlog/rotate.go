@@ -0,0 +1,223 @@
+package jsonlog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 轮转后的文件名中的时间格式，按照文件名排序就是按照时间排序
+const rotateTimeFormat = "2006-01-02T15-04-05.000"
+
+// rename 用于轮转时重命名文件，测试中替换为返回错误的函数来模拟轮转失败
+var rename = os.Rename
+
+// clock 返回轮转文件名中使用的时间，测试中替换为固定的时间来模拟同一毫秒内的多次轮转
+var clock = time.Now
+
+// RotateOptions 控制日志文件的轮转和保留，值为0的选项不生效
+type RotateOptions struct {
+	// MaxSize 文件超过这个字节数时轮转
+	MaxSize int64
+	// Interval 文件打开超过这个时间后轮转
+	Interval time.Duration
+	// MaxBackups 最多保留的轮转文件个数
+	MaxBackups int
+	// MaxAge 轮转文件最多保留的时间
+	MaxAge time.Duration
+}
+
+// RotatingFile 是按大小和时间轮转的日志文件。轮转时当前文件被重命名为
+// "名称-时间.扩展名"，然后按照保留策略删除旧的轮转文件
+type RotatingFile struct {
+	path   string
+	opts   RotateOptions
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	closed bool
+}
+
+// OpenRotatingFile 以追加模式打开path，目录不存在时会被创建
+func OpenRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	f := &RotatingFile{path: path, opts: opts}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+
+	return nil
+}
+
+// Write 写入p，需要时先轮转文件。轮转失败时仍然写入当前的文件，并在写入成功时返回轮转的错误
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	// 上一次轮转之后没能重新打开文件时，每次写入都再尝试打开
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	var rotateErr error
+	if f.shouldRotate(int64(len(p))) {
+		rotateErr = f.rotate()
+		if f.file == nil {
+			return 0, rotateErr
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+
+	if err == nil {
+		err = rotateErr
+	}
+
+	return n, err
+}
+
+// shouldRotate 判断写入n个字节之前是否需要轮转，空文件不轮转，避免单行超过MaxSize时反复轮转
+func (f *RotatingFile) shouldRotate(n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+
+	if f.opts.MaxSize > 0 && f.size+n > f.opts.MaxSize {
+		return true
+	}
+
+	return f.opts.Interval > 0 && time.Since(f.opened) >= f.opts.Interval
+}
+
+// rotate 把当前文件重命名为轮转文件并重新打开path。重命名失败时path仍然是原来的文件，
+// 重新打开后继续追加，所以轮转失败不会让日志中断
+func (f *RotatingFile) rotate() error {
+	closeErr := f.file.Close()
+	f.file = nil
+
+	renameErr := rename(f.path, f.backupName())
+
+	if err := f.open(); err != nil {
+		return errors.Join(closeErr, renameErr, err)
+	}
+
+	if err := errors.Join(closeErr, renameErr); err != nil {
+		return err
+	}
+
+	return f.prune()
+}
+
+// backupName 返回还不存在的轮转文件名。同一毫秒内多次轮转时把时间向后推1毫秒，
+// 而不是覆盖已有的轮转文件，这样文件名的顺序仍然是轮转的顺序
+func (f *RotatingFile) backupName() string {
+	ext := filepath.Ext(f.path)
+	base := strings.TrimSuffix(f.path, ext)
+
+	for t := clock().UTC(); ; t = t.Add(time.Millisecond) {
+		backup := fmt.Sprintf("%s-%s%s", base, t.Format(rotateTimeFormat), ext)
+		if _, err := os.Lstat(backup); errors.Is(err, os.ErrNotExist) {
+			return backup
+		}
+	}
+}
+
+// prune 删除超过MaxBackups个数或者MaxAge时间的轮转文件
+func (f *RotatingFile) prune() error {
+	if f.opts.MaxBackups <= 0 && f.opts.MaxAge <= 0 {
+		return nil
+	}
+
+	ext := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(f.path, ext) + "-"
+
+	matches, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return err
+	}
+
+	// 只处理文件名中带有轮转时间的文件，避免删除同一目录下名称相近的其他日志
+	var backups []string
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, prefix), ext)
+		if _, err := time.Parse(rotateTimeFormat, stamp); err == nil {
+			backups = append(backups, match)
+		}
+	}
+
+	// 最新的轮转文件排在最前面
+	slices.Sort(backups)
+	slices.Reverse(backups)
+
+	for i, backup := range backups {
+		expired := f.opts.MaxBackups > 0 && i >= f.opts.MaxBackups
+
+		if !expired && f.opts.MaxAge > 0 {
+			info, err := os.Stat(backup)
+			if err != nil {
+				continue
+			}
+			expired = time.Since(info.ModTime()) > f.opts.MaxAge
+		}
+
+		if expired {
+			if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
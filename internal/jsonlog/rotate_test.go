@@ -0,0 +1,277 @@
+package jsonlog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.log")
+
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// 空文件不轮转，即使单行超过MaxSize
+	writeLine(t, f, strings.Repeat("a", 30))
+	if backups := listBackups(t, path); len(backups) != 0 {
+		t.Fatalf("got %d backups after first write; want 0", len(backups))
+	}
+
+	writeLine(t, f, "second")
+
+	backups := listBackups(t, path)
+	if len(backups) != 1 {
+		t.Fatalf("got %d backups; want 1", len(backups))
+	}
+
+	assertContent(t, backups[0], strings.Repeat("a", 30)+"\n")
+	assertContent(t, path, "second\n")
+
+	// 没有超过MaxSize时继续写入当前文件
+	writeLine(t, f, "third")
+	assertContent(t, path, "second\nthird\n")
+}
+
+func TestRotateByInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.log")
+
+	f, err := OpenRotatingFile(path, RotateOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	writeLine(t, f, "first")
+	writeLine(t, f, "second")
+
+	if backups := listBackups(t, path); len(backups) != 0 {
+		t.Fatalf("got %d backups before the interval; want 0", len(backups))
+	}
+
+	f.opened = time.Now().Add(-2 * time.Hour)
+	writeLine(t, f, "third")
+
+	backups := listBackups(t, path)
+	if len(backups) != 1 {
+		t.Fatalf("got %d backups; want 1", len(backups))
+	}
+
+	assertContent(t, backups[0], "first\nsecond\n")
+	assertContent(t, path, "third\n")
+}
+
+func TestRotateSameMillisecond(t *testing.T) {
+	stopped := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock = func() time.Time { return stopped }
+	t.Cleanup(func() { clock = time.Now })
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.log")
+
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first", "second", "third", "fourth"} {
+		writeLine(t, f, line)
+	}
+
+	// 每次轮转都产生新的文件，按照文件名排序就是轮转的顺序
+	backups := listBackups(t, path)
+	if len(backups) != 3 {
+		t.Fatalf("got %d backups; want 3", len(backups))
+	}
+
+	for i, want := range []string{"first\n", "second\n", "third\n"} {
+		assertContent(t, backups[i], want)
+	}
+	assertContent(t, path, "fourth\n")
+}
+
+func TestPruneMaxBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.log")
+
+	old := []string{
+		filepath.Join(dir, "api-2024-01-01T00-00-00.000.log"),
+		filepath.Join(dir, "api-2024-01-02T00-00-00.000.log"),
+		filepath.Join(dir, "api-2024-01-03T00-00-00.000.log"),
+	}
+	for _, name := range old {
+		writeFile(t, name)
+	}
+
+	// 名称相近但不是轮转文件的日志不会被删除
+	other := filepath.Join(dir, "api-access.log")
+	writeFile(t, other)
+
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 1, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	writeLine(t, f, "first")
+	writeLine(t, f, "second")
+
+	backups := listBackups(t, path)
+	if len(backups) != 2 {
+		t.Fatalf("got backups %q; want 2", backups)
+	}
+
+	// 保留最新的两个：刚刚轮转的文件和2024-01-03
+	if backups[0] != old[2] {
+		t.Errorf("got oldest backup %q; want %q", backups[0], old[2])
+	}
+	assertContent(t, backups[1], "first\n")
+
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("unrelated log was removed: %v", err)
+	}
+}
+
+func TestPruneMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.log")
+
+	expired := filepath.Join(dir, "api-2024-01-01T00-00-00.000.log")
+	recent := filepath.Join(dir, "api-2024-01-02T00-00-00.000.log")
+	writeFile(t, expired)
+	writeFile(t, recent)
+
+	longAgo := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(expired, longAgo, longAgo); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 1, MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	writeLine(t, f, "first")
+	writeLine(t, f, "second")
+
+	backups := listBackups(t, path)
+	if len(backups) != 2 || backups[0] != recent {
+		t.Fatalf("got backups %q; want %q and the new backup", backups, recent)
+	}
+}
+
+func TestRotateFailureKeepsLogging(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.log")
+
+	errRename := errors.New("rename failed")
+	rename = func(string, string) error { return errRename }
+	t.Cleanup(func() { rename = os.Rename })
+
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	writeLine(t, f, "first")
+
+	// 轮转失败时这一行仍然写入原来的文件，同时返回轮转的错误
+	n, err := f.Write([]byte("second\n"))
+	if !errors.Is(err, errRename) {
+		t.Errorf("got error %v; want %v", err, errRename)
+	}
+	if n != len("second\n") {
+		t.Errorf("wrote %d bytes; want %d", n, len("second\n"))
+	}
+
+	rename = os.Rename
+	writeLine(t, f, "third")
+
+	backups := listBackups(t, path)
+	if len(backups) != 1 {
+		t.Fatalf("got %d backups; want 1", len(backups))
+	}
+
+	assertContent(t, backups[0], "first\nsecond\n")
+	assertContent(t, path, "third\n")
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	f, err := OpenRotatingFile(filepath.Join(t.TempDir(), "api.log"), RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write([]byte("line\n")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("got error %v; want %v", err, os.ErrClosed)
+	}
+}
+
+func writeLine(t *testing.T, f *RotatingFile, line string) {
+	t.Helper()
+
+	if _, err := f.Write([]byte(line + "\n")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeFile(t *testing.T, name string) {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listBackups 按照时间从旧到新返回path的轮转文件
+func listBackups(t *testing.T, path string) []string {
+	t.Helper()
+
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(path, ext) + "-"
+
+	matches, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var backups []string
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, prefix), ext)
+		if _, err := time.Parse(rotateTimeFormat, stamp); err == nil {
+			backups = append(backups, match)
+		}
+	}
+
+	slices.Sort(backups)
+	return backups
+}
+
+func assertContent(t *testing.T, name, want string) {
+	t.Helper()
+
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != want {
+		t.Errorf("%s contains %q; want %q", filepath.Base(name), got, want)
+	}
+}
@@ -0,0 +1,47 @@
+package jsonlog
+
+import "time"
+
+// sampler 统计每个interval内每条消息出现的次数，决定是否输出。
+// 每个interval开始时清空计数，所以不同消息的数量再多也不会无限增长
+type sampler struct {
+	interval   time.Duration
+	first      int
+	thereafter int
+	reset      time.Time
+	counts     map[sampleKey]int
+}
+
+type sampleKey struct {
+	level   Level
+	message string
+}
+
+func newSampler(interval time.Duration, first, thereafter int) *sampler {
+	return &sampler{
+		interval:   interval,
+		first:      first,
+		thereafter: thereafter,
+		counts:     make(map[sampleKey]int),
+	}
+}
+
+// allow 判断这一次的消息是否输出，调用方需要持有Logger的锁
+func (s *sampler) allow(level Level, message string) bool {
+	now := time.Now()
+	if now.After(s.reset) {
+		clear(s.counts)
+		s.reset = now.Add(s.interval)
+	}
+
+	key := sampleKey{level, message}
+	s.counts[key]++
+	n := s.counts[key]
+
+	if n <= s.first {
+		return true
+	}
+
+	// thereafter为0时超过first次之后全部丢弃
+	return s.thereafter > 0 && (n-s.first)%s.thereafter == 0
+}
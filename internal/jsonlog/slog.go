@@ -0,0 +1,125 @@
+package jsonlog
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Handler 让Logger作为log/slog的后端，slog的属性会作为properties输出，分组中的属性名使用"分组.属性"的形式
+type Handler struct {
+	logger *Logger
+	attrs  []slog.Attr
+	group  string
+}
+
+// NewHandler 返回使用logger输出的slog.Handler，例如 slog.New(jsonlog.NewHandler(logger))
+func NewHandler(logger *Logger) *Handler {
+	return &Handler{logger: logger}
+}
+
+// slogLevel 把slog的级别转换为最接近的jsonlog级别
+func slogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Enabled(slogLevel(level))
+}
+
+func (h *Handler) Handle(_ context.Context, record slog.Record) error {
+	properties := make(map[string]any, len(h.attrs)+record.NumAttrs())
+
+	for _, attr := range h.attrs {
+		addAttr(properties, "", attr)
+	}
+
+	record.Attrs(func(attr slog.Attr) bool {
+		addAttr(properties, h.group, attr)
+		return true
+	})
+
+	if len(properties) == 0 {
+		properties = nil
+	}
+
+	// 使用记录中的时间，slog.Record的时间为零值时(例如手动构造的记录)不输出time字段
+	_, err := h.logger.printAt(slogLevel(record.Level), record.Time, record.Message, properties)
+	return err
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	h2.attrs = append(h2.attrs, h.attrs...)
+
+	// 在分组中添加的属性需要带上分组前缀
+	for _, attr := range attrs {
+		if h.group != "" {
+			attr.Key = h.group + "." + attr.Key
+		}
+		h2.attrs = append(h2.attrs, attr)
+	}
+
+	return &h2
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.group = prefixed(h.group, name)
+
+	return &h2
+}
+
+// addAttr 把属性写入properties，分组属性会被展开
+func addAttr(properties map[string]any, group string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	// 键为空的分组直接展开到当前分组中
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			group = prefixed(group, attr.Key)
+		}
+		for _, a := range attr.Value.Group() {
+			addAttr(properties, group, a)
+		}
+		return
+	}
+
+	properties[prefixed(group, attr.Key)] = attrValue(attr.Value)
+}
+
+func attrValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindTime:
+		return v.Time().UTC().Format(time.RFC3339)
+	case slog.KindDuration:
+		return v.Duration().String()
+	default:
+		return v.Any()
+	}
+}
+
+func prefixed(group, key string) string {
+	if group == "" {
+		return key
+	}
+	return group + "." + key
+}
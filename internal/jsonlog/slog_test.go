@@ -0,0 +1,93 @@
+package jsonlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/slogtest"
+	"time"
+)
+
+func TestHandlerConformance(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(New(&buf, LevelDebug))
+
+	results := func() []map[string]any {
+		var ms []map[string]any
+
+		scanner := bufio.NewScanner(&buf)
+		for scanner.Scan() {
+			var line struct {
+				Level      string         `json:"level"`
+				Time       string         `json:"time"`
+				Message    string         `json:"message"`
+				Properties map[string]any `json:"properties"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Fatal(err)
+			}
+
+			// slogtest要求time、level、msg三个键，分组为嵌套的map，而Logger把分组展开为"分组.属性"
+			m := map[string]any{
+				slog.LevelKey:   line.Level,
+				slog.MessageKey: line.Message,
+			}
+			if line.Time != "" {
+				m[slog.TimeKey] = line.Time
+			}
+
+			for key, value := range line.Properties {
+				parts := strings.Split(key, ".")
+				group := m
+				for _, part := range parts[:len(parts)-1] {
+					sub, ok := group[part].(map[string]any)
+					if !ok {
+						sub = make(map[string]any)
+						group[part] = sub
+					}
+					group = sub
+				}
+				group[parts[len(parts)-1]] = value
+			}
+
+			ms = append(ms, m)
+		}
+
+		if err := scanner.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		return ms
+	}
+
+	if err := slogtest.TestHandler(h, results); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandlerRecordTime(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(New(&buf, LevelDebug)))
+
+	recorded := time.Date(2024, 3, 1, 12, 30, 0, 0, time.FixedZone("CST", 8*60*60))
+	record := slog.NewRecord(recorded, slog.LevelInfo, "replayed", 0)
+
+	if err := logger.Handler().Handle(context.Background(), record); err != nil {
+		t.Fatal(err)
+	}
+
+	var line struct {
+		Time string `json:"time"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "2024-03-01T04:30:00Z"; line.Time != want {
+		t.Errorf("got time %q; want %q", line.Time, want)
+	}
+}
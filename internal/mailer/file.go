@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+)
+
+// unsafeFilenameRX 匹配文件名中不安全的字符
+var unsafeFilenameRX = regexp.MustCompile(`[^A-Za-z0-9@._-]+`)
+
+// FileMailer 把每封邮件写入dir中的一个.eml文件，用于本地开发时查看邮件
+type FileMailer struct {
+	templates *Templates
+	dir       string
+	sender    string
+	seq       atomic.Int64
+}
+
+// NewFile 创建FileMailer，dir不存在时会被创建
+func NewFile(templates *Templates, dir, sender string) (*FileMailer, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{templates: templates, dir: dir, sender: sender}, nil
+}
+
+func (m *FileMailer) Send(recipient, locale, templateFile string, data any) error {
+	msg, err := m.templates.render(m.sender, recipient, locale, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	// 文件名包含时间和序号，同一时刻发送的多封邮件不会互相覆盖
+	name := fmt.Sprintf("%s-%06d-%s.eml",
+		msg.CreatedAt.UTC().Format("20060102T150405.000000000"),
+		m.seq.Add(1),
+		unsafeFilenameRX.ReplaceAllString(recipient, "_"),
+	)
+
+	f, err := os.Create(filepath.Join(m.dir, name))
+	if err != nil {
+		return err
+	}
+
+	_, err = msg.mail().WriteTo(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"github.com/wangyaodream/greenlight/internal/jsonlog"
+)
+
+// LogMailer 不发送邮件，而是把邮件内容写入日志，用于本地开发
+type LogMailer struct {
+	templates *Templates
+	logger    *jsonlog.Logger
+	sender    string
+}
+
+func NewLog(templates *Templates, logger *jsonlog.Logger, sender string) *LogMailer {
+	return &LogMailer{templates: templates, logger: logger, sender: sender}
+}
+
+func (m *LogMailer) Send(recipient, locale, templateFile string, data any) error {
+	msg, err := m.templates.render(m.sender, recipient, locale, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	m.logger.PrintInfo("email sent", map[string]any{
+		"from":       msg.From,
+		"to":         msg.To,
+		"subject":    msg.Subject,
+		"locale":     msg.Locale,
+		"template":   msg.Template,
+		"plain_body": msg.PlainBody,
+	})
+
+	return nil
+}
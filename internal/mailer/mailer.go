@@ -3,70 +3,149 @@ package mailer
 import (
 	"bytes"
 	"embed"
-	"html/template"
+	"fmt"
+	htemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	ttemplate "text/template"
 	"time"
 
 	"github.com/go-mail/mail/v2"
 )
 
-
 //go:embed "templates"
 var templateFS embed.FS
 
-type Mailer struct {
-    dialer *mail.Dialer
-    sender string
+// FallbackLocale 是模板没有收件人语言的版本时使用的语言，每个模板都必须有这个语言的版本
+const FallbackLocale = "en"
+
+// Mailer 发送使用模板渲染的邮件，locale选择模板的语言版本，具体的发送方式由实现决定
+type Mailer interface {
+	Send(recipient, locale, templateFile string, data any) error
+}
+
+// Message 是渲染之后的邮件
+type Message struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Subject   string    `json:"subject"`
+	Locale    string    `json:"locale"`
+	Template  string    `json:"template"`
+	PlainBody string    `json:"plain_body"`
+	HTMLBody  string    `json:"html_body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// requiredTemplates 是每个模板文件必须定义的模板
+var requiredTemplates = []string{"subject", "plainBody", "htmlBody"}
+
+// Templates 保存启动时解析的所有邮件模板，键为"语言/文件名"，例如"zh/user_welcome.tmpl"。
+// subject和plainBody使用text/template渲染，避免纯文本被HTML转义，htmlBody使用html/template渲染
+type Templates struct {
+	text map[string]*ttemplate.Template
+	html map[string]*htemplate.Template
+}
+
+// LoadTemplates 解析templates目录下每个语言目录中的模板文件，任意文件缺少subject、plainBody或htmlBody，
+// 或者没有FallbackLocale版本时返回错误
+func LoadTemplates() (*Templates, error) {
+	files, err := fs.Glob(templateFS, "templates/*/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{
+		text: make(map[string]*ttemplate.Template, len(files)),
+		html: make(map[string]*htemplate.Template, len(files)),
+	}
+
+	for _, file := range files {
+		name := strings.TrimPrefix(file, "templates/")
+
+		text, err := ttemplate.New("email").ParseFS(templateFS, file)
+		if err != nil {
+			return nil, err
+		}
+
+		html, err := htemplate.New("email").ParseFS(templateFS, file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, required := range requiredTemplates {
+			if text.Lookup(required) == nil {
+				return nil, fmt.Errorf("mailer: template %s does not define %q", name, required)
+			}
+		}
+
+		t.text[name], t.html[name] = text, html
+	}
+
+	for name := range t.text {
+		fallback := path.Join(FallbackLocale, path.Base(name))
+		if _, ok := t.text[fallback]; !ok {
+			return nil, fmt.Errorf("mailer: template %s has no %s version", name, FallbackLocale)
+		}
+	}
+
+	return t, nil
 }
 
-func New(host string, port int, username, password, sender string) Mailer {
-    dialer := mail.NewDialer(host, port, username, password)
-    dialer.Timeout = 5 * time.Second
+// render 使用templateFile中的subject、plainBody和htmlBody模板渲染邮件，
+// 模板没有locale版本时使用FallbackLocale版本
+func (t *Templates) render(sender, recipient, locale, templateFile string, data any) (*Message, error) {
+	name := path.Join(locale, templateFile)
+	if _, ok := t.text[name]; !ok {
+		locale, name = FallbackLocale, path.Join(FallbackLocale, templateFile)
+	}
 
-    return Mailer{
-        dialer: dialer,
-        sender: sender,
-    }
+	text, ok := t.text[name]
+	if !ok {
+		return nil, fmt.Errorf("mailer: unknown template %s", templateFile)
+	}
+
+	subject := new(bytes.Buffer)
+	// 渲染模板并将结果写入到subject缓冲区
+	err := text.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	// 渲染模板并将结果写入到plainBody缓冲区
+	plainBody := new(bytes.Buffer)
+	err = text.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = t.html[name].ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		From:      sender,
+		To:        recipient,
+		Subject:   subject.String(),
+		Locale:    locale,
+		Template:  templateFile,
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+		CreatedAt: time.Now(),
+	}, nil
 }
 
-func (m Mailer) Send(recipient, templateFile string, data any) error {
-    tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
-    if err != nil {
-        return err
-    }
-
-    subject := new(bytes.Buffer)
-    // 渲染模板并将结果写入到subject缓冲区
-    err = tmpl.ExecuteTemplate(subject, "subject", data)
-    if err != nil {
-        return err
-    }
-
-    // 渲染模板并将结果写入到plainBody缓冲区
-    plainBody := new(bytes.Buffer)
-    err = tmpl.ExecuteTemplate(plainBody, "htmlBody", data)
-    if err != nil {
-        return err
-    }
-
-
-    htmlBody := new(bytes.Buffer)
-    err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
-    if err != nil {
-        return err
-    }
-
-    msg := mail.NewMessage()
-    msg.SetHeader("To", recipient)
-    msg.SetHeader("From", m.sender)
-    msg.SetHeader("Subject", subject.String())
-    msg.SetBody("text/plain", plainBody.String())
-    msg.AddAlternative("text/html", htmlBody.String())
-
-    // 发送邮件到SMTP服务器
-    err = m.dialer.DialAndSend(msg)
-    if err != nil {
-        return err
-    }
-
-    return nil
+// mail 把邮件转换为包含纯文本和HTML两个部分的MIME邮件
+func (msg *Message) mail() *mail.Message {
+	m := mail.NewMessage()
+	m.SetHeader("To", msg.To)
+	m.SetHeader("From", msg.From)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetDateHeader("Date", msg.CreatedAt)
+	m.SetBody("text/plain", msg.PlainBody)
+	m.AddAlternative("text/html", msg.HTMLBody)
+
+	return m
 }
@@ -0,0 +1,134 @@
+package mailer
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// testData 和发件箱worker传给模板的数据一致，数字解码为json.Number
+var testData = map[string]any{
+	"activationToken": "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU",
+	"userID":          json.Number("1234567"),
+}
+
+// TestTemplates 渲染每个语言的每个模板，并与testdata中的golden文件比较。
+// 修改模板之后使用 go test ./internal/mailer -update 重新生成golden文件
+func TestTemplates(t *testing.T) {
+	templates, err := LoadTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := fs.Glob(templateFS, "templates/*/*.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) == 0 {
+		t.Fatal("no templates found")
+	}
+
+	for _, file := range files {
+		name := strings.TrimPrefix(file, "templates/")
+		locale, templateFile := path.Split(name)
+		locale = strings.TrimSuffix(locale, "/")
+
+		t.Run(name, func(t *testing.T) {
+			msg, err := templates.render("Greenlight <no-reply@greenlight.test>", "alice@example.com", locale, templateFile, testData)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if msg.Locale != locale {
+				t.Errorf("got locale %q; want %q", msg.Locale, locale)
+			}
+
+			assertGolden(t, filepath.Join("testdata", locale, templateFile+".golden"), formatMessage(msg))
+		})
+	}
+}
+
+// TestTemplatesFallback 检查没有对应语言版本时使用FallbackLocale版本
+func TestTemplatesFallback(t *testing.T) {
+	templates, err := LoadTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := fs.Glob(templateFS, "templates/"+FallbackLocale+"/*.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		templateFile := path.Base(file)
+
+		t.Run(templateFile, func(t *testing.T) {
+			msg, err := templates.render("Greenlight <no-reply@greenlight.test>", "alice@example.com", "fr", templateFile, testData)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if msg.Locale != FallbackLocale {
+				t.Errorf("got locale %q; want %q", msg.Locale, FallbackLocale)
+			}
+
+			want, err := os.ReadFile(filepath.Join("testdata", FallbackLocale, templateFile+".golden"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := formatMessage(msg); got != string(want) {
+				t.Errorf("fallback rendering differs from %s golden file:\n%s", FallbackLocale, got)
+			}
+		})
+	}
+}
+
+func TestUnknownTemplate(t *testing.T) {
+	templates, err := LoadTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = templates.render("", "alice@example.com", "zh", "missing.tmpl", testData)
+	if err == nil {
+		t.Fatal("expected an error for an unknown template")
+	}
+}
+
+func formatMessage(msg *Message) string {
+	return fmt.Sprintf("-- subject --\n%s\n-- plainBody --\n%s\n-- htmlBody --\n%s\n", msg.Subject, msg.PlainBody, msg.HTMLBody)
+}
+
+func assertGolden(t *testing.T, golden, got string) {
+	t.Helper()
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+
+	if got != string(want) {
+		t.Errorf("rendered message differs from %s (run go test -update if the change is intended)\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
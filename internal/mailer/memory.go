@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"slices"
+	"sync"
+)
+
+// MemoryMailer 把邮件保存在内存中，集成测试可以通过Messages检查发送的邮件
+type MemoryMailer struct {
+	templates *Templates
+	sender    string
+	mu        sync.Mutex
+	messages  []Message
+}
+
+func NewMemory(templates *Templates, sender string) *MemoryMailer {
+	return &MemoryMailer{templates: templates, sender: sender}
+}
+
+func (m *MemoryMailer) Send(recipient, locale, templateFile string, data any) error {
+	msg, err := m.templates.render(m.sender, recipient, locale, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, *msg)
+
+	return nil
+}
+
+// Messages 按照发送顺序返回所有邮件的副本
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.messages)
+}
+
+// Reset 清空已经保存的邮件
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = nil
+}
@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"time"
+
+	"github.com/go-mail/mail/v2"
+)
+
+// SMTPMailer 通过SMTP服务器发送邮件
+type SMTPMailer struct {
+	templates *Templates
+	dialer    *mail.Dialer
+	sender    string
+}
+
+func NewSMTP(templates *Templates, host string, port int, username, password, sender string) *SMTPMailer {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTPMailer{
+		templates: templates,
+		dialer:    dialer,
+		sender:    sender,
+	}
+}
+
+func (m *SMTPMailer) Send(recipient, locale, templateFile string, data any) error {
+	msg, err := m.templates.render(m.sender, recipient, locale, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	// 发送邮件到SMTP服务器
+	return m.dialer.DialAndSend(msg.mail())
+}
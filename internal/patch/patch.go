@@ -0,0 +1,343 @@
+// Package patch 实现了RFC 7396 JSON Merge Patch和RFC 6902 JSON Patch，
+// 操作对象是encoding/json解码得到的通用文档(map[string]any、[]any以及标量)
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPath    = errors.New("invalid path")
+	ErrPathNotFound   = errors.New("path does not exist")
+	ErrTestFailed     = errors.New("test failed")
+	ErrInvalidOp      = errors.New("unsupported operation")
+	ErrMissingValue   = errors.New("missing value")
+	ErrMoveIntoItself = errors.New("cannot move a value into one of its children")
+)
+
+// Operation 是JSON Patch中的一个操作，Value为nil表示请求中没有value成员
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Error 记录失败的操作在patch中的位置
+type Error struct {
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("operation %d (%s %q): %s", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Merge 按照RFC 7396把patch合并到target中，patch中值为null的成员会从target中删除
+func Merge(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = Merge(t[key], value)
+	}
+
+	return t
+}
+
+// Apply 按照RFC 6902依次执行ops，任意一个操作失败时返回*Error，调用者应该丢弃整个结果
+func Apply(doc any, ops []Operation) (any, error) {
+	var err error
+
+	for i, op := range ops {
+		doc, err = applyOne(doc, op)
+		if err != nil {
+			return nil, &Error{Index: i, Op: op.Op, Path: op.Path, Err: err}
+		}
+	}
+
+	return doc, nil
+}
+
+func applyOne(doc any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, ErrMissingValue
+		}
+
+		var value any
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			// 替换整个文档时不需要经过remove，remove不允许删除根
+			if len(path) == 0 {
+				return value, nil
+			}
+			if _, err := get(doc, path); err != nil {
+				return nil, err
+			}
+			doc, err = remove(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		default:
+			current, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrTestFailed
+			}
+			return doc, nil
+		}
+
+	case "remove":
+		return remove(doc, path)
+
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "move" {
+			// 移动到原来的位置不改变文档
+			if op.From == op.Path {
+				return doc, nil
+			}
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, ErrMoveIntoItself
+			}
+			doc, err = remove(doc, from)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			value = deepCopy(value)
+		}
+
+		return add(doc, path, value)
+
+	default:
+		return nil, ErrInvalidOp
+	}
+}
+
+// parsePointer 把RFC 6901 JSON Pointer解析为引用标记，空字符串表示整个文档
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, ErrInvalidPath
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]any:
+			value, ok := container[token]
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			doc = value
+		case []any:
+			i, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[i]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+
+	return doc, nil
+}
+
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(doc, path, func(parent any, token string) (any, error) {
+		switch container := parent.(type) {
+		case map[string]any:
+			container[token] = value
+			return container, nil
+		case []any:
+			// "-" 表示追加到数组末尾
+			if token == "-" {
+				return append(container, value), nil
+			}
+			i, err := arrayIndex(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[i+1:], container[i:])
+			container[i] = value
+			return container, nil
+		default:
+			return nil, ErrPathNotFound
+		}
+	})
+}
+
+func remove(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, ErrInvalidPath
+	}
+
+	return update(doc, path, func(parent any, token string) (any, error) {
+		switch container := parent.(type) {
+		case map[string]any:
+			if _, ok := container[token]; !ok {
+				return nil, ErrPathNotFound
+			}
+			delete(container, token)
+			return container, nil
+		case []any:
+			i, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(container[:i], container[i+1:]...), nil
+		default:
+			return nil, ErrPathNotFound
+		}
+	})
+}
+
+// update 找到path的父容器并调用fn修改，fn返回的新容器会写回上一级
+func update(doc any, path []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	switch container := doc.(type) {
+	case map[string]any:
+		child, ok := container[path[0]]
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		child, err := update(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		container[path[0]] = child
+		return container, nil
+	case []any:
+		i, err := arrayIndex(path[0], len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := update(container[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		container[i] = child
+		return container, nil
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+// arrayIndex 解析数组下标，下标不能有前导零并且不能超过max
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, ErrInvalidPath
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, ErrInvalidPath
+	}
+
+	if i > max {
+		return 0, ErrPathNotFound
+	}
+
+	return i, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for key, item := range v {
+			c[key] = deepCopy(item)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, item := range v {
+			c[i] = deepCopy(item)
+		}
+		return c
+	default:
+		return v
+	}
+}
@@ -0,0 +1,190 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		ops  string
+		want string
+	}{
+		// add
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`},
+		{"add replaces existing member", `{"a":1}`, `[{"op":"add","path":"/a","value":[1]}]`, `{"a":[1]}`},
+		{"add null value", `{}`, `[{"op":"add","path":"/a","value":null}]`, `{"a":null}`},
+		{"add nested member", `{"a":{"b":1}}`, `[{"op":"add","path":"/a/c","value":2}]`, `{"a":{"b":1,"c":2}}`},
+		{"add to array front", `{"a":[1,2]}`, `[{"op":"add","path":"/a/0","value":0}]`, `{"a":[0,1,2]}`},
+		{"add to array middle", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`},
+		{"add at array length", `{"a":[1,2]}`, `[{"op":"add","path":"/a/2","value":3}]`, `{"a":[1,2,3]}`},
+		{"add with dash appends", `{"a":[1,2]}`, `[{"op":"add","path":"/a/-","value":3}]`, `{"a":[1,2,3]}`},
+		{"add dash to empty array", `{"a":[]}`, `[{"op":"add","path":"/a/-","value":1}]`, `{"a":[1]}`},
+		{"add root", `{"a":1}`, `[{"op":"add","path":"","value":[1]}]`, `[1]`},
+		{"add empty key", `{}`, `[{"op":"add","path":"/","value":1}]`, `{"":1}`},
+
+		// remove
+		{"remove member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`},
+		{"remove array item", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`},
+		{"remove last array item", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/2"}]`, `{"a":[1,2]}`},
+
+		// replace
+		{"replace member", `{"a":1}`, `[{"op":"replace","path":"/a","value":"x"}]`, `{"a":"x"}`},
+		{"replace array item", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/0","value":0}]`, `{"a":[0,2]}`},
+		{"replace root", `{"a":1}`, `[{"op":"replace","path":"","value":{"b":2}}]`, `{"b":2}`},
+
+		// move
+		{"move member", `{"a":1,"b":{}}`, `[{"op":"move","from":"/a","path":"/b/a"}]`, `{"b":{"a":1}}`},
+		{"move array item", `{"a":[1,2,3]}`, `[{"op":"move","from":"/a/0","path":"/a/-"}]`, `{"a":[2,3,1]}`},
+		{"move onto itself", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a"}]`, `{"a":{"b":1}}`},
+		{"move to root", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":""}]`, `{"b":1}`},
+
+		// copy
+		{"copy member", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"}]`, `{"a":{"b":1},"c":{"b":1}}`},
+		{"copy is deep", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"copy into array", `{"a":[1],"b":2}`, `[{"op":"copy","from":"/b","path":"/a/0"}]`, `{"a":[2,1],"b":2}`},
+
+		// test
+		{"test passes", `{"a":{"b":[1,"x"]}}`, `[{"op":"test","path":"/a","value":{"b":[1,"x"]}}]`, `{"a":{"b":[1,"x"]}}`},
+		{"test root", `[1]`, `[{"op":"test","path":"","value":[1]}]`, `[1]`},
+
+		// ~0和~1转义
+		{"escaped slash", `{"a/b":1}`, `[{"op":"replace","path":"/a~1b","value":2}]`, `{"a/b":2}`},
+		{"escaped tilde", `{"m~n":1}`, `[{"op":"remove","path":"/m~0n"}]`, `{}`},
+		{"escape order", `{"~1":1}`, `[{"op":"replace","path":"/~01","value":2}]`, `{"~1":2}`},
+		{"escaped from", `{"a/b":1}`, `[{"op":"move","from":"/a~1b","path":"/c~0d"}]`, `{"c~d":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(decode(t, tt.doc), decodeOps(t, tt.ops))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		ops   string
+		index int
+		want  error
+	}{
+		{"unknown op", `{}`, `[{"op":"frobnicate","path":"/a"}]`, 0, ErrInvalidOp},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`, 0, ErrMissingValue},
+		{"pointer without slash", `{}`, `[{"op":"add","path":"a","value":1}]`, 0, ErrInvalidPath},
+		{"add to missing parent", `{}`, `[{"op":"add","path":"/a/b","value":1}]`, 0, ErrPathNotFound},
+		{"add past array end", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":1}]`, 0, ErrPathNotFound},
+		{"add with leading zero", `{"a":[1]}`, `[{"op":"add","path":"/a/01","value":1}]`, 0, ErrInvalidPath},
+		{"add with negative index", `{"a":[1]}`, `[{"op":"add","path":"/a/-1","value":1}]`, 0, ErrInvalidPath},
+		{"add to scalar", `{"a":1}`, `[{"op":"add","path":"/a/b","value":1}]`, 0, ErrPathNotFound},
+		{"remove missing member", `{}`, `[{"op":"remove","path":"/a"}]`, 0, ErrPathNotFound},
+		{"remove past array end", `{"a":[1]}`, `[{"op":"remove","path":"/a/1"}]`, 0, ErrPathNotFound},
+		{"remove dash", `{"a":[1]}`, `[{"op":"remove","path":"/a/-"}]`, 0, ErrInvalidPath},
+		{"remove root", `{}`, `[{"op":"remove","path":""}]`, 0, ErrInvalidPath},
+		{"replace missing member", `{}`, `[{"op":"replace","path":"/a","value":1}]`, 0, ErrPathNotFound},
+		{"replace dash", `{"a":[1]}`, `[{"op":"replace","path":"/a/-","value":1}]`, 0, ErrInvalidPath},
+		{"move missing from", `{}`, `[{"op":"move","from":"/a","path":"/b"}]`, 0, ErrPathNotFound},
+		{"move into child", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, 0, ErrMoveIntoItself},
+		{"copy missing from", `{}`, `[{"op":"copy","from":"/a","path":"/b"}]`, 0, ErrPathNotFound},
+		{"test different value", `{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, 0, ErrTestFailed},
+		{"test different type", `{"a":1}`, `[{"op":"test","path":"/a","value":"1"}]`, 0, ErrTestFailed},
+		{"test missing member", `{}`, `[{"op":"test","path":"/a","value":null}]`, 0, ErrPathNotFound},
+		{"error index", `{}`, `[{"op":"add","path":"/a","value":1},{"op":"test","path":"/a","value":2}]`, 1, ErrTestFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Apply(decode(t, tt.doc), decodeOps(t, tt.ops))
+
+			var patchErr *Error
+			if !errors.As(err, &patchErr) {
+				t.Fatalf("got error %v; want *Error", err)
+			}
+
+			if patchErr.Index != tt.index {
+				t.Errorf("got index %d; want %d", patchErr.Index, tt.index)
+			}
+
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{"replace member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"add member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"null removes member", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"arrays are replaced", `{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`},
+		{"nested merge", `{"a":{"b":1,"c":2}}`, `{"a":{"c":null,"d":3}}`, `{"a":{"b":1,"d":3}}`},
+		{"non-object patch replaces target", `{"a":1}`, `[1]`, `[1]`},
+		{"object patch on scalar target", `1`, `{"a":1}`, `{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Merge(decode(t, tt.target), decode(t, tt.patch))
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+func decode(t *testing.T, s string) any {
+	t.Helper()
+
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func decodeOps(t *testing.T, s string) []Operation {
+	t.Helper()
+
+	var ops []Operation
+	if err := json.Unmarshal([]byte(s), &ops); err != nil {
+		t.Fatal(err)
+	}
+	return ops
+}
+
+// assertJSON 比较编码之后的JSON，encoding/json按照键排序编码map，所以不受成员顺序影响
+func assertJSON(t *testing.T, got any, want string) {
+	t.Helper()
+
+	js, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(js) != string(mustCompact(t, want)) {
+		t.Errorf("got %s; want %s", js, want)
+	}
+}
+
+func mustCompact(t *testing.T, s string) []byte {
+	t.Helper()
+
+	js, err := json.Marshal(decode(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return js
+}
@@ -0,0 +1,90 @@
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// marshalCSV 把数组编码为CSV，表头为所有元素中出现过的键(按照第一次出现的顺序)。
+// 数组元素不是对象时只有一个value列；标量数组用竖线连接，嵌套的对象和数组编码为JSON文本
+func marshalCSV(rows []any) ([]byte, error) {
+	var (
+		header  []string
+		columns = make(map[string]int)
+	)
+
+	for _, row := range rows {
+		obj, ok := row.(object)
+		if !ok {
+			obj = object{{key: "value", value: row}}
+		}
+
+		for _, m := range obj {
+			if _, ok := columns[m.key]; !ok {
+				columns[m.key] = len(header)
+				header = append(header, m.key)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		obj, ok := row.(object)
+		if !ok {
+			obj = object{{key: "value", value: row}}
+		}
+
+		record := make([]string, len(header))
+		for _, m := range obj {
+			cell, err := csvCell(m.value)
+			if err != nil {
+				return nil, err
+			}
+			record[columns[m.key]] = cell
+		}
+
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func csvCell(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number, bool:
+		return fmt.Sprint(v), nil
+	case []any:
+		cells := make([]string, len(v))
+		for i, item := range v {
+			switch item.(type) {
+			case object, []any:
+				return jsonText(v)
+			}
+			cells[i], _ = csvCell(item)
+		}
+		return strings.Join(cells, "|"), nil
+	default:
+		return jsonText(v)
+	}
+}
+
+func jsonText(value any) (string, error) {
+	js, err := json.Marshal(value)
+	return string(js), err
+}
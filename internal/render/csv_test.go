@@ -0,0 +1,98 @@
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	data := map[string]any{
+		"metadata": map[string]any{"total_records": 2},
+		"movies": []map[string]any{
+			{"id": 1, "title": "Casablanca", "genres": []string{"drama", "romance"}},
+			{"id": 2, "title": "Quote \"and\", comma\nnewline", "year": 1999, "cast": []map[string]any{{"name": "x"}}},
+		},
+	}
+
+	doc, err := NewDocument(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !doc.Tabular() {
+		t.Fatal("expected document to be tabular")
+	}
+
+	body, err := doc.Marshal(CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 表头按照键第一次出现的顺序，NewDocument经过encoding/json，所以每个对象的键按字母排序
+	want := [][]string{
+		{"genres", "id", "title", "cast", "year"},
+		{"drama|romance", "1", "Casablanca", "", ""},
+		{"", "2", "Quote \"and\", comma\nnewline", `[{"name":"x"}]`, "1999"},
+	}
+
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got %q; want %q", records, want)
+	}
+}
+
+func TestCSVScalarRows(t *testing.T) {
+	doc, err := NewDocument(map[string]any{"genres": []string{"drama", "comedy"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := doc.Marshal(CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{{"value"}, {"drama"}, {"comedy"}}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got %q; want %q", records, want)
+	}
+}
+
+func TestCSVNotTabular(t *testing.T) {
+	tests := []struct {
+		name string
+		data any
+	}{
+		{"object", map[string]any{"movie": map[string]any{"id": 1}}},
+		{"two arrays", map[string]any{"a": []int{1}, "b": []int{2}}},
+		{"top-level array", []int{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := NewDocument(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if doc.Tabular() {
+				t.Error("expected document not to be tabular")
+			}
+
+			if _, err := doc.Marshal(CSV); err != ErrNotTabular {
+				t.Errorf("got error %v; want %v", err, ErrNotTabular)
+			}
+		})
+	}
+}
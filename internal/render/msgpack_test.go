@@ -0,0 +1,251 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMessagePackRoundTrip(t *testing.T) {
+	ints := []int64{
+		0, 1, 127, 128, 255, 256, math.MaxUint16, math.MaxUint16 + 1, math.MaxUint32, math.MaxUint32 + 1, math.MaxInt64,
+		-1, -32, -33, math.MinInt8, math.MinInt8 - 1, math.MinInt16, math.MinInt16 - 1, math.MinInt32, math.MinInt32 - 1, math.MinInt64,
+	}
+
+	for _, i := range ints {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			roundTrip(t, i, i)
+		})
+	}
+
+	for _, n := range []int{0, 31, 32, math.MaxUint8, math.MaxUint8 + 1, math.MaxUint16, math.MaxUint16 + 1} {
+		t.Run(fmt.Sprintf("string of %d bytes", n), func(t *testing.T) {
+			s := strings.Repeat("a", n)
+			roundTrip(t, s, s)
+		})
+	}
+
+	for _, n := range []int{0, 15, 16, math.MaxUint16 + 1} {
+		t.Run(fmt.Sprintf("array of %d items", n), func(t *testing.T) {
+			in := make([]bool, n)
+			want := make([]any, n)
+			for i := range want {
+				want[i] = false
+			}
+			roundTrip(t, in, want)
+		})
+	}
+
+	t.Run("document", func(t *testing.T) {
+		in := map[string]any{
+			"movie": map[string]any{
+				"id":      1,
+				"title":   "电影",
+				"rating":  7.5,
+				"genres":  []string{"drama"},
+				"runtime": nil,
+				"active":  true,
+			},
+		}
+		want := map[string]any{
+			"movie": map[string]any{
+				"id":      int64(1),
+				"title":   "电影",
+				"rating":  7.5,
+				"genres":  []any{"drama"},
+				"runtime": nil,
+				"active":  true,
+			},
+		}
+		roundTrip(t, in, want)
+	})
+
+	t.Run("map of 16 members", func(t *testing.T) {
+		in := make(map[string]int)
+		want := make(map[string]any)
+		for i := range 16 {
+			in[fmt.Sprint(i)] = i
+			want[fmt.Sprint(i)] = int64(i)
+		}
+		roundTrip(t, in, want)
+	})
+}
+
+func roundTrip(t *testing.T, in, want any) {
+	t.Helper()
+
+	doc, err := NewDocument(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := doc.Marshal(MessagePack)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := bytes.NewReader(body)
+	got, err := decodeMessagePack(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Len() != 0 {
+		t.Errorf("%d trailing bytes", r.Len())
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v; want %#v", got, want)
+	}
+}
+
+// decodeMessagePack 解码encodeMessagePack使用的格式，整数解码为int64，对象解码为map[string]any
+func decodeMessagePack(r *bytes.Reader) (any, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return decodeMessagePackMap(r, int(b&0x0f))
+	case b&0xf0 == 0x90:
+		return decodeMessagePackArray(r, int(b&0x0f))
+	case b&0xe0 == 0xa0:
+		return decodeMessagePackString(r, int(b&0x1f))
+	}
+
+	var (
+		u8  uint8
+		u16 uint16
+		u32 uint32
+		u64 uint64
+		i8  int8
+		i16 int16
+		i32 int32
+		i64 int64
+	)
+
+	read := func(v any) error { return binary.Read(r, binary.BigEndian, v) }
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcb:
+		err = read(&u64)
+		return math.Float64frombits(u64), err
+	case 0xcc:
+		err = read(&u8)
+		return int64(u8), err
+	case 0xcd:
+		err = read(&u16)
+		return int64(u16), err
+	case 0xce:
+		err = read(&u32)
+		return int64(u32), err
+	case 0xcf:
+		err = read(&u64)
+		return int64(u64), err
+	case 0xd0:
+		err = read(&i8)
+		return int64(i8), err
+	case 0xd1:
+		err = read(&i16)
+		return int64(i16), err
+	case 0xd2:
+		err = read(&i32)
+		return int64(i32), err
+	case 0xd3:
+		err = read(&i64)
+		return i64, err
+	case 0xd9:
+		if err := read(&u8); err != nil {
+			return nil, err
+		}
+		return decodeMessagePackString(r, int(u8))
+	case 0xda:
+		if err := read(&u16); err != nil {
+			return nil, err
+		}
+		return decodeMessagePackString(r, int(u16))
+	case 0xdb:
+		if err := read(&u32); err != nil {
+			return nil, err
+		}
+		return decodeMessagePackString(r, int(u32))
+	case 0xdc:
+		if err := read(&u16); err != nil {
+			return nil, err
+		}
+		return decodeMessagePackArray(r, int(u16))
+	case 0xdd:
+		if err := read(&u32); err != nil {
+			return nil, err
+		}
+		return decodeMessagePackArray(r, int(u32))
+	case 0xde:
+		if err := read(&u16); err != nil {
+			return nil, err
+		}
+		return decodeMessagePackMap(r, int(u16))
+	case 0xdf:
+		if err := read(&u32); err != nil {
+			return nil, err
+		}
+		return decodeMessagePackMap(r, int(u32))
+	}
+
+	return nil, fmt.Errorf("unexpected format byte %#x", b)
+}
+
+func decodeMessagePackString(r *bytes.Reader, n int) (any, error) {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(r, buf)
+	return string(buf), err
+}
+
+func decodeMessagePackArray(r *bytes.Reader, n int) (any, error) {
+	items := make([]any, n)
+	for i := range items {
+		item, err := decodeMessagePack(r)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+func decodeMessagePackMap(r *bytes.Reader, n int) (any, error) {
+	m := make(map[string]any, n)
+	for range n {
+		key, err := decodeMessagePack(r)
+		if err != nil {
+			return nil, err
+		}
+
+		s, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key of type %T", key)
+		}
+
+		m[s], err = decodeMessagePack(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
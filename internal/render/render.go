@@ -0,0 +1,279 @@
+// Package render 按照Accept请求头选择响应格式，并把响应数据编码为JSON、XML、CSV或MessagePack。
+// 非JSON格式先把数据按照JSON编码再解析为通用的文档树，所以各种格式共享json标签和MarshalJSON方法
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// 支持的媒体类型
+const (
+	JSON        = "application/json"
+	XML         = "application/xml"
+	CSV         = "text/csv"
+	MessagePack = "application/msgpack"
+)
+
+// MediaTypes 是所有支持的媒体类型，顺序即服务器的偏好顺序
+var MediaTypes = []string{JSON, XML, MessagePack, CSV}
+
+// aliases 把常见的别名映射到支持的媒体类型
+var aliases = map[string]string{
+	"text/xml":                XML,
+	"application/x-msgpack":   MessagePack,
+	"application/vnd.msgpack": MessagePack,
+}
+
+var ErrNotTabular = errors.New("data cannot be represented as CSV")
+
+// Negotiate 按照Accept请求头从offers中选择客户端最偏好的类型，q值相同时按照offers的顺序选择。
+// accept为空时返回offers[0]，没有可接受的类型时返回false
+func Negotiate(accept string, offers ...string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	ranges := parseAccept(accept)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := quality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best, best != ""
+}
+
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+		if alias, ok := aliases[mediaType]; ok {
+			mediaType = alias
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "q") {
+				if f, err := strconv.ParseFloat(value, 64); err == nil && f >= 0 && f <= 1 {
+					q = f
+				}
+			}
+		}
+
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+	}
+
+	return ranges
+}
+
+// quality 返回offer在ranges中最具体的匹配项的q值，完全匹配优先于type/*，type/*优先于*/*
+func quality(ranges []mediaRange, offer string) float64 {
+	offerType, _, _ := strings.Cut(offer, "/")
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		var s int
+		switch {
+		case r.mediaType == offer:
+			s = 2
+		case r.mediaType == offerType+"/*":
+			s = 1
+		case r.mediaType == "*/*":
+			s = 0
+		default:
+			continue
+		}
+
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+
+	return q
+}
+
+// ContentType 返回mediaType对应的Content-Type响应头
+func ContentType(mediaType string) string {
+	switch mediaType {
+	case XML, CSV:
+		return mediaType + "; charset=utf-8"
+	default:
+		return mediaType
+	}
+}
+
+// Document 保存需要编码的数据以及由它的JSON编码得到的文档树
+type Document struct {
+	value any
+	tree  any
+}
+
+// NewDocument 把v转换为文档树，文档树中的值为nil、bool、json.Number、string、[]any或object
+func NewDocument(v any) (*Document, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	tree, err := decodeValue(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Document{value: v, tree: tree}, nil
+}
+
+// Tabular 判断文档是否可以编码为CSV：顶层对象中必须恰好有一个数组成员
+func (d *Document) Tabular() bool {
+	_, ok := d.table()
+	return ok
+}
+
+func (d *Document) table() ([]any, bool) {
+	obj, ok := d.tree.(object)
+	if !ok {
+		return nil, false
+	}
+
+	var rows []any
+	found := 0
+
+	for _, m := range obj {
+		if items, ok := m.value.([]any); ok {
+			rows = items
+			found++
+		}
+	}
+
+	return rows, found == 1
+}
+
+// Marshal 把文档编码为mediaType格式
+func (d *Document) Marshal(mediaType string) ([]byte, error) {
+	switch mediaType {
+	case JSON:
+		js, err := json.MarshalIndent(d.value, "", "\t")
+		if err != nil {
+			return nil, err
+		}
+		return append(js, '\n'), nil
+	case XML:
+		return marshalXML(d.tree)
+	case CSV:
+		rows, ok := d.table()
+		if !ok {
+			return nil, ErrNotTabular
+		}
+		return marshalCSV(rows)
+	case MessagePack:
+		var buf bytes.Buffer
+		err := encodeMessagePack(&buf, d.tree)
+		return buf.Bytes(), err
+	default:
+		return nil, errors.New("unsupported media type " + mediaType)
+	}
+}
+
+// object 是保留成员顺序的JSON对象
+type object []member
+
+type member struct {
+	key   string
+	value any
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func decodeValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+
+	switch delim {
+	case '{':
+		obj := object{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			obj = append(obj, member{key: key.(string), value: value})
+		}
+		_, err = dec.Token()
+		return obj, err
+
+	default:
+		items := []any{}
+		for dec.More() {
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		_, err = dec.Token()
+		return items, err
+	}
+}
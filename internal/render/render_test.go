@@ -0,0 +1,33 @@
+package render
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		offers []string
+		want   string
+		ok     bool
+	}{
+		{"", MediaTypes, JSON, true},
+		{"*/*", MediaTypes, JSON, true},
+		{"application/xml", MediaTypes, XML, true},
+		{"text/xml", MediaTypes, XML, true},
+		{"application/x-msgpack", MediaTypes, MessagePack, true},
+		{"text/*", MediaTypes, CSV, true},
+		{"application/json;q=0.5, text/csv", MediaTypes, CSV, true},
+		{"text/csv;q=0.5, */*;q=0.5", MediaTypes, JSON, true},
+		{"text/csv", []string{JSON, XML, MessagePack}, "", false},
+		{"application/json;q=0", MediaTypes[:1], "", false},
+		{"image/png", MediaTypes, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			got, ok := Negotiate(tt.accept, tt.offers...)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("got (%q, %v); want (%q, %v)", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+)
+
+// xmlNameRX 匹配可以直接作为元素名的键，其他键使用带name属性的entry元素
+var xmlNameRX = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// marshalXML 把文档树编码为以response为根元素的XML，数组中的每个元素编码为item元素
+func marshalXML(tree any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "\t")
+
+	err := encodeXMLElement(enc, xml.StartElement{Name: xml.Name{Local: "response"}}, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func encodeXMLElement(enc *xml.Encoder, start xml.StartElement, value any) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case nil:
+	case object:
+		for _, m := range v {
+			if err := encodeXMLElement(enc, xmlElement(m.key), m.value); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err := encodeXMLElement(enc, xml.StartElement{Name: xml.Name{Local: "item"}}, item); err != nil {
+				return err
+			}
+		}
+	case json.Number, string, bool:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported value of type %T", value)
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+func xmlElement(key string) xml.StartElement {
+	if xmlNameRX.MatchString(key) {
+		return xml.StartElement{Name: xml.Name{Local: key}}
+	}
+
+	return xml.StartElement{
+		Name: xml.Name{Local: "entry"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: key}},
+	}
+}
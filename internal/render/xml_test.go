@@ -0,0 +1,67 @@
+package render
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+func TestXMLRoundTrip(t *testing.T) {
+	data := map[string]any{
+		"movie": map[string]any{
+			"id":       42,
+			"title":    "Tom & Jerry <Part 2>",
+			"genres":   []string{"animation", "comedy"},
+			"runtime":  nil,
+			"released": true,
+			"1st key":  "entry value",
+		},
+	}
+
+	doc, err := NewDocument(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := doc.Marshal(XML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		XMLName xml.Name `xml:"response"`
+		Movie   struct {
+			ID       int64    `xml:"id"`
+			Title    string   `xml:"title"`
+			Genres   []string `xml:"genres>item"`
+			Runtime  *string  `xml:"runtime"`
+			Released bool     `xml:"released"`
+			Entries  []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"entry"`
+		} `xml:"movie"`
+	}
+
+	if err := xml.Unmarshal(body, &got); err != nil {
+		t.Fatalf("unmarshal %s: %v", body, err)
+	}
+
+	m := got.Movie
+	if m.ID != 42 || m.Title != "Tom & Jerry <Part 2>" || !m.Released {
+		t.Errorf("got %+v", m)
+	}
+
+	if want := []string{"animation", "comedy"}; !reflect.DeepEqual(m.Genres, want) {
+		t.Errorf("got genres %q; want %q", m.Genres, want)
+	}
+
+	// null编码为空元素
+	if m.Runtime == nil || *m.Runtime != "" {
+		t.Errorf("got runtime %v; want empty element", m.Runtime)
+	}
+
+	if len(m.Entries) != 1 || m.Entries[0].Name != "1st key" || m.Entries[0].Value != "entry value" {
+		t.Errorf("got entries %+v", m.Entries)
+	}
+}
@@ -0,0 +1,168 @@
+// settings 读取配置文件和环境变量中的设置。
+// 设置统一使用与命令行参数相同的名称，例如YAML中的db.dsn、TOML中[db]下的dsn和环境变量GREENLIGHT_DB_DSN都对应db-dsn，
+// 列表被转换为逗号分隔的字符串，所以结果可以直接传给flag.FlagSet.Set
+package settings
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ReadFile 按照扩展名读取YAML(.yaml, .yml)或TOML(.toml)配置文件。
+// 只支持配置需要的子集：嵌套的键、字符串、数字、布尔值和字符串列表
+func ReadFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]string
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		values, err = parseYAML(string(content))
+	case ".toml":
+		values, err = parseTOML(string(content))
+	default:
+		return nil, fmt.Errorf("%s: unsupported configuration format %q, use .yaml, .yml or .toml", path, ext)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+// FromEnv 返回environ中以prefix_开头的环境变量，例如prefix为GREENLIGHT时GREENLIGHT_DB_DSN对应db-dsn
+func FromEnv(prefix string, environ []string) map[string]string {
+	values := make(map[string]string)
+
+	for _, kv := range environ {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(key, prefix+"_") {
+			continue
+		}
+
+		values[Normalize(strings.TrimPrefix(key, prefix+"_"))] = value
+	}
+
+	return values
+}
+
+// Normalize 把键转换为命令行参数的形式：小写，使用-分隔单词和层级
+func Normalize(key string) string {
+	return strings.NewReplacer("_", "-", ".", "-").Replace(strings.ToLower(strings.TrimSpace(key)))
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "-" + key
+}
+
+// stripComment 去掉不在引号中的#及其后面的内容，#必须位于行首或者空白之后
+func stripComment(line string) string {
+	var quote byte
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+// splitList 按照不在引号中的逗号拆分列表
+func splitList(s string) []string {
+	var (
+		items []string
+		quote byte
+		start int
+	)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		items = append(items, last)
+	}
+
+	return items
+}
+
+// scalar 解析单个值，双引号字符串支持转义，单引号字符串中两个单引号表示一个单引号
+func scalar(s string) (string, error) {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case strings.HasPrefix(s, `"`):
+		value, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		return value, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	default:
+		return s, nil
+	}
+}
+
+// value 解析一个值，[a, b]形式的列表被转换为逗号分隔的字符串
+func value(s string) (string, error) {
+	s = strings.TrimSpace(s)
+
+	if !strings.HasPrefix(s, "[") {
+		return scalar(s)
+	}
+
+	if !strings.HasSuffix(s, "]") {
+		return "", fmt.Errorf("unterminated list %s", s)
+	}
+
+	var items []string
+	for _, item := range splitList(s[1 : len(s)-1]) {
+		v, err := scalar(item)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, v)
+	}
+
+	return strings.Join(items, ","), nil
+}
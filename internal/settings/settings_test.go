@@ -0,0 +1,81 @@
+package settings
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFromEnv(t *testing.T) {
+	environ := []string{
+		"GREENLIGHT_DB_DSN=postgres://u:p=w@h/db",
+		"GREENLIGHT_CORS_TRUSTED_ORIGINS=https://a.com https://b.com",
+		"GREENLIGHTX_PORT=1",
+		"PORT=2",
+		"GREENLIGHT_EMPTY=",
+	}
+
+	want := map[string]string{
+		"db-dsn":               "postgres://u:p=w@h/db",
+		"cors-trusted-origins": "https://a.com https://b.com",
+		"empty":                "",
+	}
+
+	if got := FromEnv("GREENLIGHT", environ); !maps.Equal(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"config.yaml": "db:\n  dsn: x\n",
+		"config.yml":  "db:\n  dsn: x\n",
+		"config.toml": "[db]\ndsn = 'x'\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := map[string]string{"db-dsn": "x"}; !maps.Equal(got, want) {
+				t.Errorf("got %q; want %q", got, want)
+			}
+		})
+	}
+
+	t.Run("unsupported format", func(t *testing.T) {
+		path := filepath.Join(dir, "config.json")
+		if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := ReadFile(path)
+		if err == nil || !strings.Contains(err.Error(), "unsupported configuration format") {
+			t.Errorf("got error %v", err)
+		}
+	})
+
+	t.Run("errors include the path", func(t *testing.T) {
+		path := filepath.Join(dir, "broken.yaml")
+		if err := os.WriteFile(path, []byte("- a\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := ReadFile(path)
+		if err == nil || !strings.HasPrefix(err.Error(), path+": line 1:") {
+			t.Errorf("got error %v", err)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package settings
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseTOML 解析[section]形式的表和key = value形式的键值，值可以是字符串、数字、布尔值或者列表，
+// 列表可以跨越多行。不支持内联表和表数组
+func parseTOML(content string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	var (
+		section string
+		pending string // 尚未结束的多行列表
+		start   int
+	)
+
+	for i, raw := range strings.Split(content, "\n") {
+		text := strings.TrimSpace(stripComment(raw))
+
+		if pending != "" {
+			pending += " " + text
+			if !strings.HasSuffix(text, "]") {
+				continue
+			}
+			text, pending = pending, ""
+		} else if text == "" {
+			continue
+		} else {
+			start = i + 1
+		}
+
+		if strings.HasPrefix(text, "[[") {
+			return nil, fmt.Errorf("line %d: arrays of tables are not supported", start)
+		}
+
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("line %d: invalid table header %s", start, text)
+			}
+			section = Normalize(text[1 : len(text)-1])
+			continue
+		}
+
+		name, rest, ok := strings.Cut(text, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("line %d: expected key = value", start)
+		}
+
+		rest = strings.TrimSpace(rest)
+
+		if strings.HasPrefix(rest, "{") {
+			return nil, fmt.Errorf("line %d: inline tables are not supported", start)
+		}
+
+		if strings.HasPrefix(rest, "[") && !strings.HasSuffix(rest, "]") {
+			pending = text
+			continue
+		}
+
+		v, err := value(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", start, err)
+		}
+
+		values[join(section, Normalize(strings.Trim(strings.TrimSpace(name), `"'`)))] = v
+	}
+
+	if pending != "" {
+		return nil, fmt.Errorf("line %d: unterminated list", start)
+	}
+
+	return values, nil
+}
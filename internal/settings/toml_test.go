@@ -0,0 +1,102 @@
+package settings
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name: "tables",
+			content: `
+port = 4000
+env = "development" # comment
+
+[db]
+dsn = "postgres://greenlight@localhost/greenlight?sslmode=disable"
+max_open_conns = 25
+
+[smtp]
+"user.name" = 'alice'
+`,
+			want: map[string]string{
+				"port":              "4000",
+				"env":               "development",
+				"db-dsn":            "postgres://greenlight@localhost/greenlight?sslmode=disable",
+				"db-max-open-conns": "25",
+				"smtp-user-name":    "alice",
+			},
+		},
+		{
+			name: "nested table",
+			content: `
+[log.file]
+max-backups = 3
+`,
+			want: map[string]string{"log-file-max-backups": "3"},
+		},
+		{
+			name: "lists",
+			content: `
+[cors]
+trusted_origins = ["https://a.com", 'https://b.com']
+more = [
+  "https://c.com", # comment
+  "https://d.com",
+]
+`,
+			want: map[string]string{
+				"cors-trusted-origins": "https://a.com,https://b.com",
+				"cors-more":            "https://c.com,https://d.com",
+			},
+		},
+		{
+			name:    "hash inside a string",
+			content: `password = "p#ss # word"`,
+			want:    map[string]string{"password": "p#ss # word"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"array of tables", "[[servers]]", "line 1: arrays of tables are not supported"},
+		{"invalid table header", "[db", "line 1: invalid table header"},
+		{"missing equals", "port 4000", "line 1: expected key = value"},
+		{"inline table", "db = { dsn = 'x' }", "line 1: inline tables are not supported"},
+		{"unterminated list", "origins = [\n  'a',\n", "line 1: unterminated list"},
+		{"invalid string", `name = "abc`, "line 1: invalid string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML(tt.content)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v; want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// parseYAML 解析使用空格缩进的YAML映射，值可以是标量、[a, b]形式的列表或者"- "开头的列表项。
+// 不支持锚点、多行字符串、多个文档以及除了[a, b]之外的流式集合，遇到时返回带有行号的错误，
+// 而不是把它们当作标量
+func parseYAML(content string) (map[string]string, error) {
+	type frame struct {
+		indent int
+		key    string
+	}
+
+	var stack []frame
+
+	values := make(map[string]string)
+	lists := make(map[string][]string)
+
+	for i, raw := range strings.Split(content, "\n") {
+		line := strings.TrimRight(stripComment(raw), " \t\r")
+		text := strings.TrimLeft(line, " ")
+
+		if text == "" || text == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: indentation must use spaces", i+1)
+		}
+
+		indent := len(line) - len(text)
+		item := text == "-" || strings.HasPrefix(text, "- ")
+
+		// 键只属于缩进更小的父节点，而列表项可以和父节点的键使用相同的缩进，例如
+		//   trusted-origins:
+		//   - https://www.example.com
+		for len(stack) > 0 && (indent < stack[len(stack)-1].indent || !item && indent == stack[len(stack)-1].indent) {
+			stack = stack[:len(stack)-1]
+		}
+
+		if item {
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: list item without a key", i+1)
+			}
+
+			if err := flowCollection(strings.TrimPrefix(text, "-")); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+
+			item, err := scalar(strings.TrimPrefix(text, "-"))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+
+			parent := stack[len(stack)-1].key
+			lists[parent] = append(lists[parent], item)
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(text, "{"):
+			return nil, fmt.Errorf("line %d: flow mappings are not supported", i+1)
+		case strings.HasPrefix(text, "["):
+			return nil, fmt.Errorf("line %d: flow sequences must be the value of a key", i+1)
+		}
+
+		name, rest, ok := strings.Cut(text, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("line %d: expected key: value", i+1)
+		}
+
+		key := Normalize(name)
+		if len(stack) > 0 {
+			key = join(stack[len(stack)-1].key, key)
+		}
+
+		rest = strings.TrimSpace(rest)
+
+		switch rest {
+		case "":
+			// 没有值的键是下面几行的映射或者列表的父节点
+			stack = append(stack, frame{indent: indent, key: key})
+		case "|", ">", "|-", ">-":
+			return nil, fmt.Errorf("line %d: multi-line strings are not supported", i+1)
+		default:
+			if strings.HasPrefix(rest, "{") {
+				return nil, fmt.Errorf("line %d: flow mappings are not supported", i+1)
+			}
+
+			v, err := value(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+
+			// [a, b]形式的列表中只能是标量
+			if strings.HasPrefix(rest, "[") {
+				for _, item := range splitList(rest[1 : len(rest)-1]) {
+					if err := flowCollection(item); err != nil {
+						return nil, fmt.Errorf("line %d: %w", i+1, err)
+					}
+				}
+			}
+
+			values[key] = v
+		}
+	}
+
+	for key, items := range lists {
+		values[key] = strings.Join(items, ",")
+	}
+
+	return values, nil
+}
+
+// flowCollection 拒绝出现在只允许标量的位置上的流式集合，例如列表项中的{a: b}和[a, b]
+func flowCollection(s string) error {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case strings.HasPrefix(s, "{"):
+		return errors.New("flow mappings are not supported")
+	case strings.HasPrefix(s, "["):
+		return errors.New("nested flow sequences are not supported")
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package settings
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name: "nested keys",
+			content: `
+port: 4000
+db:
+  dsn: "postgres://greenlight@localhost/greenlight?sslmode=disable"
+  max-open-conns: 25 # comment
+limiter:
+  rps: 2.5
+  enabled: true
+`,
+			want: map[string]string{
+				"port":              "4000",
+				"db-dsn":            "postgres://greenlight@localhost/greenlight?sslmode=disable",
+				"db-max-open-conns": "25",
+				"limiter-rps":       "2.5",
+				"limiter-enabled":   "true",
+			},
+		},
+		{
+			name: "indented list items",
+			content: `
+cors:
+  trusted-origins:
+    - https://a.com
+    - "https://b.com"
+env: development
+`,
+			want: map[string]string{
+				"cors-trusted-origins": "https://a.com,https://b.com",
+				"env":                  "development",
+			},
+		},
+		{
+			name: "quoted braces and brackets",
+			content: `
+smtp:
+  sender: "{Greenlight} <no-reply@greenlight.net>"
+cors:
+  trusted-origins:
+    - '[::1]'
+`,
+			want: map[string]string{
+				"smtp-sender":          "{Greenlight} <no-reply@greenlight.net>",
+				"cors-trusted-origins": "[::1]",
+			},
+		},
+		{
+			name: "list items at the same indent as their key",
+			content: `
+cors:
+  trusted-origins:
+  - https://a.com
+  - https://b.com
+  other: x
+`,
+			want: map[string]string{
+				"cors-trusted-origins": "https://a.com,https://b.com",
+				"cors-other":           "x",
+			},
+		},
+		{
+			name: "top-level list items at indent zero",
+			content: `
+origins:
+- https://a.com
+- https://b.com
+port: 4000
+`,
+			want: map[string]string{
+				"origins": "https://a.com,https://b.com",
+				"port":    "4000",
+			},
+		},
+		{
+			name:    "flow list",
+			content: `origins: [https://a.com, 'https://b.com', "c, d"]`,
+			want:    map[string]string{"origins": "https://a.com,https://b.com,c, d"},
+		},
+		{
+			name: "quoted strings and hashes",
+			content: `
+sender: "Greenlight <no-reply@greenlight.test>" # comment
+password: 'it''s#secret'
+hash: "a # b"
+`,
+			want: map[string]string{
+				"sender":   "Greenlight <no-reply@greenlight.test>",
+				"password": "it's#secret",
+				"hash":     "a # b",
+			},
+		},
+		{
+			name: "keys are normalized",
+			content: `
+smtp:
+  User_Name: alice
+log.level: debug
+`,
+			want: map[string]string{
+				"smtp-user-name": "alice",
+				"log-level":      "debug",
+			},
+		},
+		{
+			name: "document marker",
+			content: `---
+port: 4000
+`,
+			want: map[string]string{"port": "4000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"list item without a key", "- a", "line 1: list item without a key"},
+		{"tab indentation", "db:\n\tdsn: x", "line 2: indentation must use spaces"},
+		{"missing colon", "port 4000", "line 1: expected key: value"},
+		{"multi-line string", "body: |\n  text", "line 1: multi-line strings are not supported"},
+		{"unterminated list", "origins: [a, b", "line 1: unterminated list"},
+		{"invalid string", `name: "abc`, "line 1: invalid string"},
+		{"flow mapping value", "db: {dsn: x}", "line 1: flow mappings are not supported"},
+		{"flow mapping line", "cors:\n  {origins: x}", "line 2: flow mappings are not supported"},
+		{"flow mapping item", "origins:\n  - {a: b}", "line 2: flow mappings are not supported"},
+		{"flow sequence item", "origins:\n  - [x, y]", "line 2: nested flow sequences are not supported"},
+		{"nested flow sequence", "origins: [a, [b, c]]", "line 1: nested flow sequences are not supported"},
+		{"flow mapping in flow sequence", "origins: [a, {b: c}]", "line 1: flow mappings are not supported"},
+		{"flow sequence line", "[a, b]", "line 1: flow sequences must be the value of a key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML(tt.content)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v; want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'lists:write';
+DROP TABLE IF EXISTS lists_movies;
+DROP TABLE IF EXISTS lists;
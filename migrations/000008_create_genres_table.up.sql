@@ -0,0 +1,98 @@
+CREATE TABLE IF NOT EXISTS genres (
+    slug text PRIMARY KEY,
+    name text NOT NULL
+);
+
+-- alias 统一保存为小写，查询时使用 lower() 实现大小写不敏感的匹配
+CREATE TABLE IF NOT EXISTS genre_aliases (
+    alias text PRIMARY KEY,
+    genre_slug text NOT NULL REFERENCES genres ON DELETE CASCADE
+);
+
+INSERT INTO genres (slug, name)
+VALUES
+    ('action', 'Action'),
+    ('adventure', 'Adventure'),
+    ('animation', 'Animation'),
+    ('biography', 'Biography'),
+    ('comedy', 'Comedy'),
+    ('crime', 'Crime'),
+    ('documentary', 'Documentary'),
+    ('drama', 'Drama'),
+    ('family', 'Family'),
+    ('fantasy', 'Fantasy'),
+    ('history', 'History'),
+    ('horror', 'Horror'),
+    ('music', 'Music'),
+    ('musical', 'Musical'),
+    ('mystery', 'Mystery'),
+    ('noir', 'Film Noir'),
+    ('romance', 'Romance'),
+    ('sci-fi', 'Science Fiction'),
+    ('sport', 'Sport'),
+    ('thriller', 'Thriller'),
+    ('war', 'War'),
+    ('western', 'Western')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO genre_aliases (alias, genre_slug)
+VALUES
+    ('science fiction', 'sci-fi'),
+    ('science-fiction', 'sci-fi'),
+    ('sci fi', 'sci-fi'),
+    ('scifi', 'sci-fi'),
+    ('sf', 'sci-fi'),
+    ('film noir', 'noir'),
+    ('film-noir', 'noir'),
+    ('animated', 'animation'),
+    ('biopic', 'biography'),
+    ('historical', 'history'),
+    ('romantic', 'romance'),
+    ('sports', 'sport'),
+    ('doc', 'documentary')
+ON CONFLICT DO NOTHING;
+
+-- 把现有电影中未知的类型补充到 genres 表中，slug 由名称转换而来
+INSERT INTO genres (slug, name)
+SELECT DISTINCT ON (slug) slug, name
+FROM (
+    SELECT trim(BOTH '-' FROM regexp_replace(lower(g.name), '[^a-z0-9]+', '-', 'g')) AS slug, g.name
+    FROM movies, unnest(movies.genres) AS g(name)
+    WHERE NOT EXISTS (SELECT 1 FROM genre_aliases WHERE alias = lower(g.name))
+) AS unknown
+WHERE slug <> ''
+ORDER BY slug, name
+ON CONFLICT DO NOTHING;
+
+-- 每个类型的 slug 和名称本身都作为别名
+INSERT INTO genre_aliases (alias, genre_slug)
+SELECT lower(slug), slug FROM genres
+ON CONFLICT DO NOTHING;
+
+INSERT INTO genre_aliases (alias, genre_slug)
+SELECT lower(name), slug FROM genres
+ON CONFLICT DO NOTHING;
+
+-- 名称转换后的 slug 与已有类型冲突时(例如 "Sci.Fi" 转换为 sci-fi)上面没有插入新类型，
+-- 把这些名称本身补充为对应 slug 的别名，避免下面统一类型时被丢弃
+INSERT INTO genre_aliases (alias, genre_slug)
+SELECT DISTINCT lower(g.name), genres.slug
+FROM movies, unnest(movies.genres) AS g(name)
+INNER JOIN genres ON genres.slug = trim(BOTH '-' FROM regexp_replace(lower(g.name), '[^a-z0-9]+', '-', 'g'))
+ON CONFLICT DO NOTHING;
+
+-- 把现有电影的类型统一为规范的 slug，同时去掉重复的类型并保持原有顺序，
+-- 仍然无法匹配的类型(例如不包含字母和数字的名称)保留原来的值
+UPDATE movies
+SET genres = normalised.genres, version = version + 1
+FROM (
+    SELECT id, array_agg(slug ORDER BY first_position) AS genres
+    FROM (
+        SELECT movies.id, coalesce(genre_aliases.genre_slug, g.name) AS slug, min(g.position) AS first_position
+        FROM movies, unnest(movies.genres) WITH ORDINALITY AS g(name, position)
+        LEFT JOIN genre_aliases ON genre_aliases.alias = lower(g.name)
+        GROUP BY movies.id, coalesce(genre_aliases.genre_slug, g.name)
+    ) AS mapped
+    GROUP BY id
+) AS normalised
+WHERE movies.id = normalised.id AND movies.genres <> normalised.genres;
@@ -0,0 +1,2 @@
+-- 使用 -search-config=english 时全文搜索需要对应配置的表达式索引
+CREATE INDEX IF NOT EXISTS movies_title_english_idx ON movies USING GIN (to_tsvector('english', title));
@@ -0,0 +1,18 @@
+-- 电影的修改记录，只会追加不会修改，version 与修改之后电影的 version 一致
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    version integer NOT NULL,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    action text NOT NULL CHECK (action IN ('insert', 'update', 'delete', 'restore')),
+    previous jsonb,
+    current jsonb,
+    PRIMARY KEY (movie_id, version)
+);
+
+-- 为已有的电影补充一条基准记录，这样迁移之前创建的电影也能查看修改记录并恢复到当前状态
+INSERT INTO movie_revisions (movie_id, version, user_id, created_at, action, previous, current)
+SELECT id, version, NULL, created_at, 'insert', NULL,
+    jsonb_build_object('title', title, 'year', year, 'runtime', runtime || ' mins', 'genres', genres)
+FROM movies
+ON CONFLICT DO NOTHING;
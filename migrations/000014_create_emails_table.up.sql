@@ -0,0 +1,22 @@
+-- 待发送邮件的发件箱，由后台worker发送，失败时按照next_attempt_at重试，
+-- 超过最大尝试次数之后状态变为dead
+CREATE TABLE IF NOT EXISTS emails (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    recipient text NOT NULL,
+    template text NOT NULL,
+    data jsonb NOT NULL DEFAULT '{}',
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_error text NOT NULL DEFAULT '',
+    sent_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS emails_pending_idx ON emails (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS emails_status_idx ON emails (status, created_at);
+
+INSERT INTO permissions (code)
+VALUES
+    ('emails:read'),
+    ('emails:write');
@@ -0,0 +1,3 @@
+-- 用户的语言偏好，决定发送邮件时使用的模板
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale text NOT NULL DEFAULT 'en';
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS locale text NOT NULL DEFAULT 'en';